@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/uswitch/klint/admission"
+)
+
+func runAdmission(opts *options) {
+	cfg, _ := loadConfig(opts, nil)
+	rules, _ := loadRules(opts, cfg)
+
+	handler, err := admission.NewHandler(rules, opts.admissionDeny)
+	if err != nil {
+		log.Fatalf("error creating admission handler: %s", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/validate", handler)
+
+	log.Infof("serving admission webhook on %s", opts.admissionAddress)
+
+	err = http.ListenAndServeTLS(opts.admissionAddress, opts.admissionCert, opts.admissionKey, mux)
+	log.Fatalf("error serving admission webhook: %s", err)
+}
@@ -0,0 +1,138 @@
+// Package admission serves an admission webhook that runs klint's rules
+// against objects as they are created or updated, so that feedback turns up
+// in kubectl's output rather than in Slack some minutes later.
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"github.com/uswitch/klint/engine"
+)
+
+type Mode string
+
+const (
+	// ModeWarn admits the object and returns the rule's alerts as warnings.
+	ModeWarn Mode = "warn"
+	// ModeDeny rejects the object if the rule raises any alerts.
+	ModeDeny Mode = "deny"
+)
+
+type Handler struct {
+	rules []*engine.Rule
+	modes map[string]Mode
+}
+
+// NewHandler creates a Handler for rules. Rules named in deny reject objects
+// that break them, all others only warn.
+func NewHandler(rules []*engine.Rule, deny []string) (*Handler, error) {
+	known := map[string]bool{}
+	for _, rule := range rules {
+		known[rule.Name] = true
+	}
+
+	modes := map[string]Mode{}
+	for _, name := range deny {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown rule %q", name)
+		}
+		modes[name] = ModeDeny
+	}
+
+	return &Handler{rules: rules, modes: modes}, nil
+}
+
+func (h *Handler) mode(rule *engine.Rule) Mode {
+	if mode, ok := h.modes[rule.Name]; ok {
+		return mode
+	}
+	return ModeWarn
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	review := &admissionv1.AdmissionReview{}
+	if err := json.NewDecoder(r.Body).Decode(review); err != nil {
+		http.Error(w, fmt.Sprintf("error decoding AdmissionReview: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if review.Request == nil {
+		http.Error(w, "AdmissionReview has no request", http.StatusBadRequest)
+		return
+	}
+
+	review.Response = h.Review(review.Request)
+	review.Response.UID = review.Request.UID
+	review.Request = nil
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		log.Errorf("error writing AdmissionReview response: %s", err)
+	}
+}
+
+// Review runs the rules against the object being admitted. Rules see it as
+// though it were new, so they report everything wrong with it rather than
+// only what changed.
+func (h *Handler) Review(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	response := &admissionv1.AdmissionResponse{Allowed: true}
+
+	if len(req.Object.Raw) == 0 { // deletes have nothing to check
+		return response
+	}
+
+	obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(req.Object.Raw, nil, nil)
+	if runtime.IsNotRegisteredError(err) { // a custom resource, which only dynamic Wants accept
+		obj, _, err = unstructured.UnstructuredJSONScheme.Decode(req.Object.Raw, nil, nil)
+	}
+	if err != nil {
+		log.Errorf("error decoding %s: %s", req.Kind, err)
+		return response
+	}
+
+	// objects being created don't always have their namespace set yet
+	if metaObj, err := meta.Accessor(obj); err == nil && metaObj.GetNamespace() == "" {
+		metaObj.SetNamespace(req.Namespace)
+	}
+
+	denials := []string{}
+	for _, alert := range engine.Evaluate(h.rules, nil, nil, obj) {
+		message := fmt.Sprintf("[%s] %s", alert.Rule.Name, strings.Join(strings.Fields(alert.Message), " "))
+
+		if h.mode(alert.Rule) == ModeDeny {
+			denials = append(denials, message)
+		} else {
+			response.Warnings = append(response.Warnings, message)
+		}
+	}
+
+	logger := log.WithFields(log.Fields{"kind": req.Kind.Kind, "namespace": req.Namespace, "name": req.Name})
+
+	if len(denials) > 0 {
+		logger.Infof("denied: %s", strings.Join(denials, "; "))
+
+		response.Allowed = false
+		response.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Reason:  metav1.StatusReasonForbidden,
+			Code:    http.StatusForbidden,
+			Message: strings.Join(denials, "\n"),
+		}
+	} else if len(response.Warnings) > 0 {
+		logger.Debugf("admitted with warnings: %s", strings.Join(response.Warnings, "; "))
+	}
+
+	return response
+}
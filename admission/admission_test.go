@@ -0,0 +1,110 @@
+package admission
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/uswitch/klint/engine"
+	"github.com/uswitch/klint/rules"
+)
+
+func review(t *testing.T, handler http.Handler, obj runtime.Object) *admissionv1.AdmissionResponse {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := &admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       "1234",
+			Namespace: "frontend",
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	}
+
+	body, _ := json.Marshal(request)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("POST", "/validate", bytes.NewReader(body)))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", recorder.Code, recorder.Body)
+	}
+
+	response := &admissionv1.AdmissionReview{}
+	if err := json.NewDecoder(recorder.Body).Decode(response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Response.UID != "1234" {
+		t.Fatalf("response UID %q doesn't match request", response.Response.UID)
+	}
+
+	return response.Response
+}
+
+var ingress = &networkingv1.Ingress{
+	TypeMeta:   metav1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "Ingress"},
+	ObjectMeta: metav1.ObjectMeta{Name: "web"},
+}
+
+func TestWarn(t *testing.T) {
+	handler, _ := NewHandler([]*engine.Rule{rules.IngressNeedsAnnotation}, nil)
+
+	response := review(t, handler, ingress)
+
+	if !response.Allowed {
+		t.Fatal("expected object to be allowed")
+	}
+
+	if len(response.Warnings) != 1 || !strings.HasPrefix(response.Warnings[0], "[IngressNeedsAnnotation] ") || !strings.Contains(response.Warnings[0], "frontend.web") {
+		t.Fatalf("unexpected warnings %v", response.Warnings)
+	}
+}
+
+func TestDeny(t *testing.T) {
+	handler, _ := NewHandler([]*engine.Rule{rules.IngressNeedsAnnotation}, []string{"IngressNeedsAnnotation"})
+
+	response := review(t, handler, ingress)
+
+	if response.Allowed {
+		t.Fatal("expected object to be denied")
+	}
+
+	if response.Result == nil || !strings.Contains(response.Result.Message, "IngressNeedsAnnotation") {
+		t.Fatalf("unexpected result %v", response.Result)
+	}
+}
+
+func TestUnknownRule(t *testing.T) {
+	if _, err := NewHandler([]*engine.Rule{rules.IngressNeedsAnnotation}, []string{"Nope"}); err == nil {
+		t.Fatal("expected an error for an unknown rule")
+	}
+}
+
+func TestResolutionsArentViolations(t *testing.T) {
+	resolves := engine.NewRule(
+		engine.RuleMeta{Name: "ResolvesRule"},
+		func(_ runtime.Object, new runtime.Object, ctx *engine.RuleHandlerContext) {
+			ctx.Resolvef(new, "Thanks for sorting it")
+		},
+		engine.WantIngress,
+	)
+	handler, _ := NewHandler([]*engine.Rule{resolves}, []string{"ResolvesRule"})
+
+	response := review(t, handler, ingress)
+
+	if !response.Allowed || len(response.Warnings) != 0 {
+		t.Fatalf("expected object to be allowed without warnings, got %v", response)
+	}
+}
@@ -0,0 +1,136 @@
+package alerts
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const logsMessage = "Pod `team.web` (container: `app`) has failed with exit code: `137`\n\n```panic: <nil>\ngoroutine 1```"
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		message, text, logs string
+	}{
+		{"plain", "plain", ""},
+		{"Pod `web` isn't ready", "Pod web isn't ready", ""},
+		{logsMessage, "Pod team.web (container: app) has failed with exit code: 137", "panic: <nil>\ngoroutine 1"},
+		{"```", "", ""},
+	}
+
+	for _, test := range tests {
+		if text, logs := splitMessage(test.message); text != test.text || logs != test.logs {
+			t.Errorf("%q: expected %q and logs %q, got %q and %q", test.message, test.text, test.logs, text, logs)
+		}
+	}
+}
+
+type chatRequest struct {
+	path string
+	body map[string]interface{}
+}
+
+func chatServer(t *testing.T) (*httptest.Server, <-chan chatRequest) {
+	t.Helper()
+
+	ch := make(chan chatRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+
+		body := map[string]interface{}{}
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("error decoding %s: %s", data, err)
+		}
+
+		ch <- chatRequest{path: r.URL.RequestURI(), body: body}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, ch
+}
+
+// unescapedJSON encodes v without escaping HTML, so it can be compared.
+func unescapedJSON(v interface{}) string {
+	buf := &strings.Builder{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(v)
+	return buf.String()
+}
+
+func TestMSTeamsSendsAdaptiveCard(t *testing.T) {
+	server, ch := chatServer(t)
+	output := NewMSTeamsOutput(map[string]string{"platform": server.URL + "/webhook"})
+
+	alert := testAlert()
+	alert.Message = logsMessage
+	if err := output.Send("platform", alert); err != nil {
+		t.Fatal(err)
+	}
+	if err := output.Send("nowhere", alert); err == nil {
+		t.Error("expected an error sending to a webhook that isn't configured")
+	}
+
+	got := <-ch
+	card := unescapedJSON(got.body)
+
+	for _, expected := range []string{
+		`"contentType":"application/vnd.microsoft.card.adaptive"`,
+		`"text":"[FIRING] TestRule"`,
+		`"text":"Pod team.web (container: app) has failed with exit code: 137"`,
+		`{"title":"Pod","value":"web"}`,
+		`"fontType":"Monospace"`,
+		`"text":"panic: <nil>\ngoroutine 1"`,
+	} {
+		if !strings.Contains(card, expected) {
+			t.Errorf("expected card to contain %s, got %s", expected, card)
+		}
+	}
+	if strings.Contains(card, "`") {
+		t.Errorf("expected no Slack markdown in %s", card)
+	}
+}
+
+func TestGoogleChatSendsCard(t *testing.T) {
+	server, ch := chatServer(t)
+	output := NewGoogleChatOutput(map[string]string{"platform": server.URL + "/v1/spaces/abc/messages?key=k&token=t"})
+
+	alert := testAlert()
+	alert.Message = logsMessage
+	if err := output.Send("platform", alert); err != nil {
+		t.Fatal(err)
+	}
+
+	got := <-ch
+	if !strings.Contains(got.path, "token=t") || !strings.Contains(got.path, "threadKey=klint-1234") {
+		t.Errorf("expected the webhook's query and a thread key, got %s", got.path)
+	}
+
+	card := unescapedJSON(got.body)
+
+	for _, expected := range []string{
+		`"cardId":"klint-1234"`,
+		`"title":"[FIRING] TestRule"`,
+		`"subtitle":"Pod/team/web"`,
+		`has failed with exit code: 137`,
+		`"header":"Logs"`,
+		`"text":"panic: &lt;nil&gt;<br>goroutine 1"`,
+	} {
+		if !strings.Contains(card, expected) {
+			t.Errorf("expected card to contain %s, got %s", expected, card)
+		}
+	}
+}
+
+func TestChatErrorsDontIncludeURL(t *testing.T) {
+	server, _ := chatServer(t)
+	server.Close()
+
+	output := NewMSTeamsOutput(map[string]string{"platform": server.URL + "/webhook?token=secret"})
+	if err := output.Send("platform", testAlert()); err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("expected an error without the webhook's URL, got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package alerts
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/uswitch/klint/engine"
+)
+
+const codeFence = "```"
+
+// splitMessage splits an alert's message, which rules write as Slack
+// markdown, into its text without any `code` markers and the logs some rules
+// add after it in a code block.
+func splitMessage(message string) (text string, logs string) {
+	text = message
+
+	if start := strings.Index(message, codeFence); start >= 0 && strings.HasSuffix(message, codeFence) && len(message)-len(codeFence) > start {
+		text = message[:start]
+		logs = strings.Trim(message[start+len(codeFence):len(message)-len(codeFence)], "\n")
+	}
+
+	return strings.TrimSpace(strings.ReplaceAll(text, "`", "")), logs
+}
+
+// title is the alert's status and rule, e.g. [FIRING] UnsuccessfulExitRule.
+func title(alert *engine.Alert) string {
+	rule := "klint"
+	if alert.Rule != nil {
+		rule = alert.Rule.Name
+	}
+	return fmt.Sprintf("[%s] %s", strings.ToUpper(string(alert.Status)), rule)
+}
+
+// alertFact is a labelled value shown alongside an alert's message.
+type alertFact struct {
+	label string
+	value string
+}
+
+func alertFacts(alert *engine.Alert) []alertFact {
+	facts := []alertFact{}
+	if alert.Object.Namespace != "" {
+		facts = append(facts, alertFact{"Namespace", alert.Object.Namespace})
+	}
+	facts = append(facts,
+		alertFact{alert.Object.Kind, alert.Object.Name},
+		alertFact{"Severity", string(alert.Severity)},
+		alertFact{"Status", string(alert.Status)},
+	)
+	if alert.Key != "" {
+		facts = append(facts, alertFact{"Key", alert.Key})
+	}
+	return facts
+}
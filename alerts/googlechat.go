@@ -0,0 +1,152 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/uswitch/klint/engine"
+)
+
+var googleChatColours = map[engine.Severity]string{
+	engine.SeverityInfo:     "#439FE0",
+	engine.SeverityWarning:  "#E8A33D",
+	engine.SeverityCritical: "#D40E0D",
+}
+
+type googleChatMessage struct {
+	CardsV2 []googleChatCard `json:"cardsV2"`
+}
+
+type googleChatCard struct {
+	CardID string                 `json:"cardId"`
+	Card   map[string]interface{} `json:"card"`
+}
+
+// GoogleChatOutput posts alerts as cards to Google Chat incoming webhooks,
+// chosen by their name in the annotation. Alerts about the same violation
+// are posted in one thread.
+type GoogleChatOutput struct {
+	client   *http.Client
+	webhooks map[string]string
+}
+
+// NewGoogleChatOutput posts to webhooks, which maps names to URLs.
+func NewGoogleChatOutput(webhooks map[string]string) *GoogleChatOutput {
+	return &GoogleChatOutput{
+		client:   &http.Client{Timeout: 30 * time.Second},
+		webhooks: webhooks,
+	}
+}
+
+func (g *GoogleChatOutput) Key() string { return "googlechat" }
+
+// chatHTML escapes text for the little HTML that card text allows.
+func chatHTML(text string) string {
+	return strings.ReplaceAll(html.EscapeString(text), "\n", "<br>")
+}
+
+func googleChatMessageFor(alert *engine.Alert) googleChatMessage {
+	text, logs := splitMessage(alert.Message)
+
+	colour := googleChatColours[alert.Severity]
+	if alert.Resolved() {
+		colour = "#2EB886"
+	}
+
+	widgets := []map[string]interface{}{
+		{"textParagraph": map[string]string{
+			"text": fmt.Sprintf(`<font color="%s"><b>%s</b></font><br>%s`, colour, strings.ToUpper(string(alert.Status)), chatHTML(text)),
+		}},
+	}
+	for _, fact := range alertFacts(alert) {
+		widgets = append(widgets, map[string]interface{}{
+			"decoratedText": map[string]string{"topLabel": fact.label, "text": html.EscapeString(fact.value)},
+		})
+	}
+	if alert.Rule != nil && alert.Rule.DocsURL != "" {
+		widgets = append(widgets, map[string]interface{}{
+			"buttonList": map[string]interface{}{
+				"buttons": []map[string]interface{}{{
+					"text":    fmt.Sprintf("About %s", alert.Rule.Name),
+					"onClick": map[string]interface{}{"openLink": map[string]string{"url": alert.Rule.DocsURL}},
+				}},
+			},
+		})
+	}
+
+	sections := []map[string]interface{}{{"widgets": widgets}}
+	if logs != "" {
+		sections = append(sections, map[string]interface{}{
+			"header":                    "Logs",
+			"collapsible":               true,
+			"uncollapsibleWidgetsCount": 0,
+			"widgets": []map[string]interface{}{
+				{"textParagraph": map[string]string{"text": chatHTML(logs)}},
+			},
+		})
+	}
+
+	return googleChatMessage{
+		CardsV2: []googleChatCard{{
+			CardID: "klint-" + alert.Fingerprint,
+			Card: map[string]interface{}{
+				"header": map[string]string{
+					"title":    title(alert),
+					"subtitle": alert.Object.String(),
+				},
+				"sections": sections,
+			},
+		}},
+	}
+}
+
+// threadURL makes webhook post in the thread for the alert's fingerprint,
+// starting it if there isn't one yet.
+func threadURL(webhook string, alert *engine.Alert) (string, error) {
+	u, err := url.Parse(webhook)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	query.Set("threadKey", "klint-"+alert.Fingerprint)
+	query.Set("messageReplyOption", "REPLY_MESSAGE_FALLBACK_TO_NEW_THREAD")
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+func (g *GoogleChatOutput) Send(name string, alert *engine.Alert) error {
+	log.Debugf("GOOGLECHAT: %s %s", name, alert.Message)
+
+	webhook, ok := g.webhooks[name]
+	if !ok {
+		return &engine.PermanentError{Err: fmt.Errorf("there is no Google Chat webhook named '%s'", name)}
+	}
+
+	u, err := threadURL(webhook, alert)
+	if err != nil {
+		return &engine.PermanentError{Err: fmt.Errorf("invalid Google Chat webhook %s: %s", name, err)}
+	}
+
+	body, err := json.Marshal(googleChatMessageFor(alert))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+
+	return checkResponse(g.client.Do(req))
+}
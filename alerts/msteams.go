@@ -0,0 +1,129 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/uswitch/klint/engine"
+)
+
+var adaptiveCardColours = map[engine.Severity]string{
+	engine.SeverityInfo:     "accent",
+	engine.SeverityWarning:  "warning",
+	engine.SeverityCritical: "attention",
+}
+
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+type teamsAttachment struct {
+	ContentType string       `json:"contentType"`
+	Content     adaptiveCard `json:"content"`
+}
+
+type adaptiveCard struct {
+	Schema  string                   `json:"$schema"`
+	Type    string                   `json:"type"`
+	Version string                   `json:"version"`
+	Body    []map[string]interface{} `json:"body"`
+	Actions []map[string]interface{} `json:"actions,omitempty"`
+	MSTeams map[string]string        `json:"msteams,omitempty"`
+}
+
+// MSTeamsOutput posts alerts as Adaptive Cards to Teams incoming webhooks,
+// chosen by their name in the annotation.
+type MSTeamsOutput struct {
+	client   *http.Client
+	webhooks map[string]string
+}
+
+// NewMSTeamsOutput posts to webhooks, which maps names to URLs.
+func NewMSTeamsOutput(webhooks map[string]string) *MSTeamsOutput {
+	return &MSTeamsOutput{
+		client:   &http.Client{Timeout: 30 * time.Second},
+		webhooks: webhooks,
+	}
+}
+
+func (t *MSTeamsOutput) Key() string { return "msteams" }
+
+func adaptiveCardFor(alert *engine.Alert) adaptiveCard {
+	text, logs := splitMessage(alert.Message)
+
+	colour := adaptiveCardColours[alert.Severity]
+	if alert.Resolved() {
+		colour = "good"
+	}
+
+	facts := []map[string]string{}
+	for _, fact := range alertFacts(alert) {
+		facts = append(facts, map[string]string{"title": fact.label, "value": fact.value})
+	}
+
+	card := adaptiveCard{
+		Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+		Type:    "AdaptiveCard",
+		Version: "1.4",
+		Body: []map[string]interface{}{
+			{"type": "TextBlock", "text": title(alert), "size": "Large", "weight": "Bolder", "color": colour, "wrap": true},
+			{"type": "TextBlock", "text": text, "wrap": true},
+			{"type": "FactSet", "facts": facts},
+		},
+		MSTeams: map[string]string{"width": "Full"},
+	}
+
+	if logs != "" {
+		card.Body = append(card.Body, map[string]interface{}{
+			"type":  "Container",
+			"style": "emphasis",
+			"bleed": true,
+			"items": []map[string]interface{}{
+				{"type": "TextBlock", "text": "Logs", "weight": "Bolder"},
+				{"type": "TextBlock", "text": logs, "fontType": "Monospace", "size": "Small", "wrap": true},
+			},
+		})
+	}
+
+	if alert.Rule != nil && alert.Rule.DocsURL != "" {
+		card.Actions = []map[string]interface{}{
+			{"type": "Action.OpenUrl", "title": fmt.Sprintf("About %s", alert.Rule.Name), "url": alert.Rule.DocsURL},
+		}
+	}
+
+	return card
+}
+
+func (t *MSTeamsOutput) Send(name string, alert *engine.Alert) error {
+	log.Debugf("MSTEAMS: %s %s", name, alert.Message)
+
+	url, ok := t.webhooks[name]
+	if !ok {
+		return &engine.PermanentError{Err: fmt.Errorf("there is no Teams webhook named '%s'", name)}
+	}
+
+	body, err := json.Marshal(teamsMessage{
+		Type: "message",
+		Attachments: []teamsAttachment{{
+			ContentType: "application/vnd.microsoft.card.adaptive",
+			Content:     adaptiveCardFor(alert),
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return checkResponse(t.client.Do(req))
+}
@@ -0,0 +1,177 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/uswitch/klint/engine"
+)
+
+const (
+	OpsgenieURL = "https://api.opsgenie.com"
+
+	// Opsgenie truncates messages longer than this
+	maxOpsgenieMessageLength = 130
+)
+
+var opsgeniePriorities = map[engine.Severity]string{
+	engine.SeverityInfo:     "P5",
+	engine.SeverityWarning:  "P3",
+	engine.SeverityCritical: "P1",
+}
+
+// opsgenieResponderTypes are the prefixes that can be given to responders
+// in the annotation. Responders without one are teams.
+var opsgenieResponderTypes = map[string]bool{
+	"team":       true,
+	"user":       true,
+	"escalation": true,
+	"schedule":   true,
+}
+
+type opsgenieResponder struct {
+	Type     string `json:"type"`
+	Name     string `json:"name,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+type opsgenieAlert struct {
+	Message     string              `json:"message"`
+	Alias       string              `json:"alias"`
+	Description string              `json:"description,omitempty"`
+	Responders  []opsgenieResponder `json:"responders,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Details     map[string]string   `json:"details,omitempty"`
+	Entity      string              `json:"entity,omitempty"`
+	Source      string              `json:"source"`
+	Priority    string              `json:"priority,omitempty"`
+}
+
+type opsgenieClose struct {
+	Source string `json:"source"`
+	Note   string `json:"note,omitempty"`
+}
+
+// OpsgenieOutput creates an alert for each violation, with its fingerprint
+// as the alias so repeats are de-duplicated, and closes it once resolved.
+// The annotation's value is a comma separated list of responders, e.g.
+// platform,user:someone@example.com.
+type OpsgenieOutput struct {
+	client *http.Client
+	url    string
+	apiKey string
+}
+
+// NewOpsgenieOutput talks to the API at url, OpsgenieURL unless it's given.
+func NewOpsgenieOutput(apiKey string, url string) *OpsgenieOutput {
+	if url == "" {
+		url = OpsgenieURL
+	}
+
+	return &OpsgenieOutput{
+		client: &http.Client{Timeout: 30 * time.Second},
+		url:    strings.TrimSuffix(url, "/"),
+		apiKey: apiKey,
+	}
+}
+
+func (o *OpsgenieOutput) Key() string { return "opsgenie" }
+
+func opsgenieResponders(target string) []opsgenieResponder {
+	responders := []opsgenieResponder{}
+
+	for _, responder := range strings.Split(target, ",") {
+		responder = strings.TrimSpace(responder)
+		if responder == "" {
+			continue
+		}
+
+		kind, name := "team", responder
+		if parts := strings.SplitN(responder, ":", 2); len(parts) == 2 && opsgenieResponderTypes[parts[0]] {
+			kind, name = parts[0], parts[1]
+		}
+
+		if kind == "user" {
+			responders = append(responders, opsgenieResponder{Type: kind, Username: name})
+		} else {
+			responders = append(responders, opsgenieResponder{Type: kind, Name: name})
+		}
+	}
+
+	return responders
+}
+
+func opsgenieAlertFor(target string, alert *engine.Alert) *opsgenieAlert {
+	message := summary(alert)
+	if len(message) > maxOpsgenieMessageLength {
+		message = message[:maxOpsgenieMessageLength]
+	}
+
+	a := &opsgenieAlert{
+		Message:     message,
+		Alias:       alert.Fingerprint,
+		Description: alert.Message,
+		Responders:  opsgenieResponders(target),
+		Tags: []string{
+			"kind:" + alert.Object.Kind,
+		},
+		Details: map[string]string{
+			"kind": alert.Object.Kind,
+			"name": alert.Object.Name,
+		},
+		Entity:   alert.Object.String(),
+		Source:   "klint",
+		Priority: opsgeniePriorities[alert.Severity],
+	}
+
+	if alert.Object.Namespace != "" {
+		a.Tags = append(a.Tags, "namespace:"+alert.Object.Namespace)
+		a.Details["namespace"] = alert.Object.Namespace
+	}
+	if alert.Rule != nil {
+		a.Tags = append(a.Tags, "rule:"+alert.Rule.Name)
+		a.Details["rule"] = alert.Rule.Name
+		if alert.Rule.DocsURL != "" {
+			a.Details["docs"] = alert.Rule.DocsURL
+		}
+	}
+	if alert.Key != "" {
+		a.Details["key"] = alert.Key
+	}
+
+	return a
+}
+
+func (o *OpsgenieOutput) post(path string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, o.url+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "GenieKey "+o.apiKey)
+
+	return checkResponse(o.client.Do(req))
+}
+
+func (o *OpsgenieOutput) Send(target string, alert *engine.Alert) error {
+	log.Debugf("OPSGENIE: %s %s", target, alert.Message)
+
+	if alert.Resolved() {
+		path := fmt.Sprintf("/v2/alerts/%s/close?identifierType=alias", url.PathEscape(alert.Fingerprint))
+		return o.post(path, &opsgenieClose{Source: "klint", Note: alert.Message})
+	}
+
+	return o.post("/v2/alerts", opsgenieAlertFor(target, alert))
+}
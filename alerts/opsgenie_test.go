@@ -0,0 +1,111 @@
+package alerts
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/uswitch/klint/engine"
+)
+
+type opsgenieRequest struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+func opsgenieServer(t *testing.T) (*OpsgenieOutput, <-chan opsgenieRequest) {
+	t.Helper()
+
+	ch := make(chan opsgenieRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ch <- opsgenieRequest{path: r.URL.RequestURI(), header: r.Header, body: body}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(server.Close)
+
+	return NewOpsgenieOutput("api-key", server.URL), ch
+}
+
+func TestOpsgenieCreates(t *testing.T) {
+	output, ch := opsgenieServer(t)
+
+	if err := output.Send("platform, user:someone@example.com, escalation:platform-escalation", testAlert()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := <-ch
+	if got.path != "/v2/alerts" {
+		t.Errorf("unexpected path %s", got.path)
+	}
+	if auth := got.header.Get("Authorization"); auth != "GenieKey api-key" {
+		t.Errorf("unexpected Authorization %q", auth)
+	}
+
+	var alert opsgenieAlert
+	if err := json.Unmarshal(got.body, &alert); err != nil {
+		t.Fatalf("error decoding %s: %s", got.body, err)
+	}
+
+	if alert.Alias != "1234" || alert.Priority != "P1" || alert.Entity != "Pod/team/web" {
+		t.Errorf("unexpected alert %+v", alert)
+	}
+
+	expectedTags := []string{"kind:Pod", "namespace:team", "rule:TestRule"}
+	if !reflect.DeepEqual(alert.Tags, expectedTags) {
+		t.Errorf("expected tags %v, got %v", expectedTags, alert.Tags)
+	}
+
+	expectedResponders := []opsgenieResponder{
+		{Type: "team", Name: "platform"},
+		{Type: "user", Username: "someone@example.com"},
+		{Type: "escalation", Name: "platform-escalation"},
+	}
+	if !reflect.DeepEqual(alert.Responders, expectedResponders) {
+		t.Errorf("expected responders %v, got %v", expectedResponders, alert.Responders)
+	}
+}
+
+func TestOpsgenieCloses(t *testing.T) {
+	output, ch := opsgenieServer(t)
+
+	alert := testAlert()
+	alert.Status = engine.StatusResolved
+	if err := output.Send("platform", alert); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := <-ch; got.path != "/v2/alerts/1234/close?identifierType=alias" {
+		t.Errorf("unexpected path %s", got.path)
+	}
+}
+
+func TestOpsgenieClientErrorsArePermanent(t *testing.T) {
+	for status, permanent := range map[int]bool{
+		http.StatusUnauthorized:        true,
+		http.StatusUnprocessableEntity: true,
+		http.StatusInternalServerError: false,
+	} {
+		server, _ := webhookServer(t, status, nil)
+
+		var permanentErr *engine.PermanentError
+		if err := NewOpsgenieOutput("api-key", server.URL).Send("platform", testAlert()); err == nil || errors.As(err, &permanentErr) != permanent {
+			t.Errorf("%d: expected permanent to be %t, got %v", status, permanent, err)
+		}
+	}
+}
+
+func TestOpsgenieRateLimited(t *testing.T) {
+	server, _ := webhookServer(t, http.StatusTooManyRequests, http.Header{"Retry-After": {"30"}})
+
+	var retry *engine.RetryAfterError
+	if err := NewOpsgenieOutput("api-key", server.URL).Send("platform", testAlert()); !errors.As(err, &retry) || retry.After != 30*time.Second {
+		t.Errorf("expected to be told to retry after 30s, got %v", err)
+	}
+}
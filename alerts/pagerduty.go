@@ -0,0 +1,156 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/uswitch/klint/engine"
+)
+
+const (
+	PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+	// PagerDuty truncates summaries longer than this
+	maxSummaryLength = 1024
+)
+
+// pagerDutySeverities maps severities to PagerDuty's, which also has error.
+var pagerDutySeverities = map[engine.Severity]string{
+	engine.SeverityInfo:     "info",
+	engine.SeverityWarning:  "warning",
+	engine.SeverityCritical: "critical",
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+	Links       []pagerDutyLink   `json:"links,omitempty"`
+	Client      string            `json:"client,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Component     string            `json:"component,omitempty"`
+	Group         string            `json:"group,omitempty"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+type pagerDutyLink struct {
+	Href string `json:"href"`
+	Text string `json:"text,omitempty"`
+}
+
+// PagerDutyOutput sends alerts as Events API v2 events to the service the
+// annotation names. Alerts for the same rule, object and
+// violation share a dedup key, so they're one incident until resolved.
+type PagerDutyOutput struct {
+	client      *http.Client
+	url         string
+	routingKeys map[string]string
+}
+
+// NewPagerDutyOutput sends events to url, PagerDutyEventsURL unless it's
+// given. routingKeys maps service names to their integration keys.
+func NewPagerDutyOutput(url string, routingKeys map[string]string) *PagerDutyOutput {
+	if url == "" {
+		url = PagerDutyEventsURL
+	}
+
+	return &PagerDutyOutput{
+		client:      &http.Client{Timeout: 30 * time.Second},
+		url:         url,
+		routingKeys: routingKeys,
+	}
+}
+
+func (p *PagerDutyOutput) Key() string { return "pagerduty" }
+
+// summary is the first line of the alert's message, which is followed by
+// things like logs for some rules, prefixed with the rule.
+func summary(alert *engine.Alert) string {
+	s := strings.SplitN(alert.Message, "\n", 2)[0]
+	if alert.Rule != nil {
+		s = fmt.Sprintf("%s: %s", alert.Rule.Name, s)
+	}
+
+	if len(s) > maxSummaryLength {
+		s = s[:maxSummaryLength]
+	}
+	return s
+}
+
+func pagerDutyEventFor(routingKey string, alert *engine.Alert) *pagerDutyEvent {
+	event := &pagerDutyEvent{
+		RoutingKey:  routingKey,
+		EventAction: "trigger",
+		DedupKey:    alert.Fingerprint,
+		Client:      "klint",
+	}
+
+	if alert.Resolved() {
+		event.EventAction = "resolve"
+		return event
+	}
+
+	event.Payload = &pagerDutyPayload{
+		Summary:   summary(alert),
+		Source:    alert.Object.String(),
+		Severity:  pagerDutySeverities[alert.Severity],
+		Component: fmt.Sprintf("%s/%s", alert.Object.Kind, alert.Object.Name),
+		Group:     alert.Object.Namespace,
+		CustomDetails: map[string]string{
+			"message":   alert.Message,
+			"namespace": alert.Object.Namespace,
+			"kind":      alert.Object.Kind,
+			"name":      alert.Object.Name,
+		},
+	}
+	if event.Payload.Severity == "" {
+		event.Payload.Severity = "warning"
+	}
+	if alert.Key != "" {
+		event.Payload.CustomDetails["key"] = alert.Key
+	}
+
+	if alert.Rule != nil {
+		event.Payload.Class = alert.Rule.Name
+		if alert.Rule.DocsURL != "" {
+			event.Links = []pagerDutyLink{{Href: alert.Rule.DocsURL, Text: alert.Rule.Name}}
+		}
+	}
+
+	return event
+}
+
+func (p *PagerDutyOutput) Send(service string, alert *engine.Alert) error {
+	log.Debugf("PAGERDUTY: %s %s %s", service, alert.Fingerprint, alert.Message)
+
+	routingKey, ok := p.routingKeys[service]
+	if !ok {
+		return &engine.PermanentError{Err: fmt.Errorf("there is no PagerDuty service named '%s'", service)}
+	}
+
+	body, err := json.Marshal(pagerDutyEventFor(routingKey, alert))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return checkResponse(p.client.Do(req))
+}
@@ -0,0 +1,100 @@
+package alerts
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/uswitch/klint/engine"
+)
+
+func newTestPagerDuty(url string) *PagerDutyOutput {
+	return NewPagerDutyOutput(url, map[string]string{"payments": "integration-key"})
+}
+
+func sendToPagerDuty(t *testing.T, alert *engine.Alert) pagerDutyEvent {
+	t.Helper()
+
+	server, ch := webhookServer(t, http.StatusAccepted, nil)
+	if err := newTestPagerDuty(server.URL).Send("payments", alert); err != nil {
+		t.Fatal(err)
+	}
+
+	var event pagerDutyEvent
+	if body := (<-ch).body; json.Unmarshal(body, &event) != nil {
+		t.Fatalf("couldn't decode event %s", body)
+	}
+	return event
+}
+
+func TestPagerDutyTriggers(t *testing.T) {
+	alert := testAlert()
+	alert.Rule.DocsURL = "https://example.com/docs"
+	alert.Message = "Container exited with 137\n\n```logs```"
+
+	event := sendToPagerDuty(t, alert)
+
+	if event.RoutingKey != "integration-key" || event.EventAction != "trigger" || event.DedupKey != alert.Fingerprint {
+		t.Errorf("unexpected event %+v", event)
+	}
+	if event.Payload == nil {
+		t.Fatal("expected a trigger to have a payload")
+	}
+	if event.Payload.Summary != "TestRule: Container exited with 137" {
+		t.Errorf("unexpected summary %q", event.Payload.Summary)
+	}
+	if event.Payload.Severity != "critical" || event.Payload.Source != "Pod/team/web" || event.Payload.Class != "TestRule" {
+		t.Errorf("unexpected payload %+v", event.Payload)
+	}
+	if event.Payload.CustomDetails["message"] != alert.Message {
+		t.Errorf("expected the whole message in the details, got %v", event.Payload.CustomDetails)
+	}
+	if len(event.Links) != 1 || event.Links[0].Href != alert.Rule.DocsURL {
+		t.Errorf("expected a link to the docs, got %v", event.Links)
+	}
+}
+
+func TestPagerDutyResolves(t *testing.T) {
+	alert := testAlert()
+	alert.Status = engine.StatusResolved
+
+	event := sendToPagerDuty(t, alert)
+
+	if event.EventAction != "resolve" || event.DedupKey != alert.Fingerprint || event.Payload != nil {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
+
+func TestPagerDutyErrors(t *testing.T) {
+	server, _ := webhookServer(t, http.StatusBadRequest, nil)
+
+	var permanent *engine.PermanentError
+	if err := newTestPagerDuty(server.URL).Send("payments", testAlert()); !errors.As(err, &permanent) {
+		t.Errorf("expected a 400 to be permanent, got %v", err)
+	}
+}
+
+func TestPagerDutyRateLimited(t *testing.T) {
+	server, _ := webhookServer(t, http.StatusTooManyRequests, http.Header{"Retry-After": {"30"}})
+
+	var retry *engine.RetryAfterError
+	if err := newTestPagerDuty(server.URL).Send("payments", testAlert()); !errors.As(err, &retry) || retry.After != 30*time.Second {
+		t.Errorf("expected to be told to retry after 30s, got %v", err)
+	}
+}
+
+func TestPagerDutyUnknownService(t *testing.T) {
+	server, ch := webhookServer(t, http.StatusAccepted, nil)
+
+	var permanent *engine.PermanentError
+	if err := newTestPagerDuty(server.URL).Send("integration-key", testAlert()); !errors.As(err, &permanent) {
+		t.Errorf("expected an unknown service to be permanent, got %v", err)
+	}
+	select {
+	case <-ch:
+		t.Error("expected nothing to be sent to PagerDuty")
+	default:
+	}
+}
@@ -1,14 +1,61 @@
 package alerts
 
 import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/nlopes/slack"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/uswitch/klint/engine"
 )
 
+var severityColours = map[engine.Severity]string{
+	engine.SeverityInfo:     "#439FE0",
+	engine.SeverityWarning:  "warning",
+	engine.SeverityCritical: "danger",
+}
+
 type SlackOutput struct {
 	client *slack.Client
 }
 
+// rateLimitedClient turns Slack's 429 responses into RetryAfterErrors so
+// that the engine waits as long as it's been asked to before trying again.
+type rateLimitedClient struct {
+	client *http.Client
+}
+
+func (c *rateLimitedClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	return nil, &engine.RetryAfterError{
+		After: retryAfter(resp.Header.Get("Retry-After")),
+		Err:   fmt.Errorf("slack rate limited: %s", resp.Status),
+	}
+}
+
+// retryAfter parses a Retry-After header given in seconds, returning 0 if it
+// can't so that the usual backoff is used instead.
+func retryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func init() {
+	slack.SetHTTPClient(&rateLimitedClient{client: &http.Client{Timeout: 30 * time.Second}})
+}
+
 func NewSlackOutput(token string) *SlackOutput {
 	return &SlackOutput{
 		client: slack.New(token),
@@ -17,19 +64,53 @@ func NewSlackOutput(token string) *SlackOutput {
 
 func (s *SlackOutput) Key() string { return "slack" }
 
-func (s *SlackOutput) Send(val string, message string) error {
-	log.Debugf("SLACK: #%s %s", val, message)
+func slackAttachment(alert *engine.Alert) slack.Attachment {
+	attachment := slack.Attachment{
+		Fallback:   alert.Text(),
+		Text:       alert.Message,
+		Color:      severityColours[alert.Severity],
+		MarkdownIn: []string{"text"},
+		Fields: []slack.AttachmentField{
+			{Title: "Namespace", Value: alert.Object.Namespace, Short: true},
+			{Title: alert.Object.Kind, Value: alert.Object.Name, Short: true},
+			{Title: "Severity", Value: string(alert.Severity), Short: true},
+			{Title: "Status", Value: string(alert.Status), Short: true},
+		},
+		Footer: alert.Fingerprint,
+	}
+
+	if alert.Resolved() {
+		attachment.Color = "good"
+	}
+
+	if alert.Rule != nil {
+		attachment.Title = fmt.Sprintf("[%s] %s", strings.ToUpper(string(alert.Status)), alert.Rule.Name)
+		attachment.TitleLink = alert.Rule.DocsURL
+	}
+
+	return attachment
+}
+
+// unknownChannelErrors are what Slack responds when it can't post to a
+// channel at all, so there's no point trying again.
+var unknownChannelErrors = map[string]bool{
+	"channel_not_found": true,
+	"not_in_channel":    true,
+	"is_archived":       true,
+}
+
+func (s *SlackOutput) Send(channel string, alert *engine.Alert) error {
+	log.Debugf("SLACK: #%s %s", channel, alert.Message)
 
 	messageParameters := slack.NewPostMessageParameters()
 	messageParameters.AsUser = true
+	messageParameters.Attachments = []slack.Attachment{slackAttachment(alert)}
 
-	var err error = nil
-
-	log.Debugf("sending alert \"%s\" to '%s'", message, val)
+	log.Debugf("sending alert \"%s\" to '%s'", alert.Message, channel)
 
-	if _, _, err = s.client.PostMessage(val, message, messageParameters); err != nil {
-		log.Errorf("Failed to send message \"%s\" to '%s': %s", message, val, err)
+	_, _, err := s.client.PostMessage(channel, "", messageParameters)
+	if err != nil && unknownChannelErrors[err.Error()] {
+		return &engine.PermanentError{Err: err}
 	}
-
 	return err
 }
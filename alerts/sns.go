@@ -1,13 +1,21 @@
 package alerts
 
 import (
+	"fmt"
+	"strings"
+
 	log "github.com/sirupsen/logrus"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sns"
+
+	"github.com/uswitch/klint/engine"
 )
 
+// SNS subjects must be ASCII, on a single line and at most 100 characters
+const maxSubjectLength = 100
+
 type SNSOutput struct {
 	client *sns.SNS
 }
@@ -24,13 +32,56 @@ func NewSNSOutput(region string) *SNSOutput {
 
 func (s *SNSOutput) Key() string { return "sns" }
 
-func (s *SNSOutput) Send(val string, message string) error {
-	log.Debugf("SNS: #%s %s", val, message)
+func snsSubject(alert *engine.Alert) string {
+	rule := "klint"
+	if alert.Rule != nil {
+		rule = alert.Rule.Name
+	}
+
+	subject := fmt.Sprintf("[%s] %s %s", strings.ToUpper(string(alert.Status)), rule, alert.Object)
+	if len(subject) > maxSubjectLength {
+		subject = subject[:maxSubjectLength]
+	}
+
+	return subject
+}
+
+func snsAttributes(alert *engine.Alert) map[string]*sns.MessageAttributeValue {
+	attributes := map[string]*sns.MessageAttributeValue{}
+
+	values := map[string]string{
+		"namespace":   alert.Object.Namespace,
+		"kind":        alert.Object.Kind,
+		"name":        alert.Object.Name,
+		"severity":    string(alert.Severity),
+		"status":      string(alert.Status),
+		"fingerprint": alert.Fingerprint,
+	}
+	if alert.Rule != nil {
+		values["rule"] = alert.Rule.Name
+	}
+
+	for k, v := range values {
+		if v == "" { // SNS rejects empty attribute values
+			continue
+		}
+		attributes[k] = &sns.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(v),
+		}
+	}
+
+	return attributes
+}
+
+func (s *SNSOutput) Send(topic string, alert *engine.Alert) error {
+	log.Debugf("SNS: #%s %s", topic, alert.Message)
 
 	params := &sns.PublishInput{
-		Subject:  aws.String(message),
-		Message:  aws.String(message),
-		TopicArn: aws.String(val),
+		Subject:           aws.String(snsSubject(alert)),
+		Message:           aws.String(alert.Text()),
+		MessageAttributes: snsAttributes(alert),
+		TopicArn:          aws.String(topic),
 	}
 	_, err := s.client.Publish(params)
 
@@ -0,0 +1,207 @@
+package alerts
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"text/template"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/uswitch/klint/engine"
+)
+
+// SignatureHeader holds the hex HMAC-SHA256 of the request body, prefixed
+// with sha256=, when a webhook has a signing secret.
+const SignatureHeader = "X-Klint-Signature"
+
+// WebhookEndpoint is somewhere alerts are POSTed to. Body is a text/template
+// given a webhookAlert; the alert is sent as JSON without one.
+type WebhookEndpoint struct {
+	URL           string
+	Headers       map[string]string
+	Body          string
+	BearerToken   string
+	Username      string
+	Password      string
+	SigningSecret string
+}
+
+// webhookAlert is what webhook bodies are rendered from.
+type webhookAlert struct {
+	Rule        string                 `json:"rule,omitempty"`
+	DocsURL     string                 `json:"docsURL,omitempty"`
+	Severity    engine.Severity        `json:"severity"`
+	Status      engine.Status          `json:"status"`
+	Object      engine.ObjectReference `json:"object"`
+	Key         string                 `json:"key,omitempty"`
+	Fingerprint string                 `json:"fingerprint"`
+	Message     string                 `json:"message"`
+}
+
+func newWebhookAlert(alert *engine.Alert) webhookAlert {
+	a := webhookAlert{
+		Severity:    alert.Severity,
+		Status:      alert.Status,
+		Object:      alert.Object,
+		Key:         alert.Key,
+		Fingerprint: alert.Fingerprint,
+		Message:     alert.Message,
+	}
+	if alert.Rule != nil {
+		a.Rule = alert.Rule.Name
+		a.DocsURL = alert.Rule.DocsURL
+	}
+	return a
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+type webhook struct {
+	WebhookEndpoint
+	body *template.Template
+}
+
+type WebhookOutput struct {
+	client    *http.Client
+	endpoints map[string]*webhook
+}
+
+// NewWebhookOutput returns an output that sends alerts to the endpoint named
+// by the annotation, failing if any of their bodies aren't valid templates.
+func NewWebhookOutput(endpoints map[string]WebhookEndpoint) (*WebhookOutput, error) {
+	output := &WebhookOutput{
+		client:    &http.Client{Timeout: 30 * time.Second},
+		endpoints: map[string]*webhook{},
+	}
+
+	for name, endpoint := range endpoints {
+		hook := &webhook{WebhookEndpoint: endpoint}
+
+		if endpoint.Body != "" {
+			body, err := template.New(name).Funcs(templateFuncs).Parse(endpoint.Body)
+			if err != nil {
+				return nil, fmt.Errorf("webhook %s: %s", name, err)
+			}
+			hook.body = body
+		}
+
+		output.endpoints[name] = hook
+	}
+
+	return output, nil
+}
+
+func (w *WebhookOutput) Key() string { return "webhook" }
+
+func (h *webhook) render(alert *engine.Alert) ([]byte, error) {
+	if h.body == nil {
+		return json.Marshal(newWebhookAlert(alert))
+	}
+
+	buf := &bytes.Buffer{}
+	if err := h.body.Execute(buf, newWebhookAlert(alert)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sign returns the value of SignatureHeader for body.
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (h *webhook) request(body []byte) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "klint")
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if h.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+h.BearerToken)
+	} else if h.Username != "" {
+		req.SetBasicAuth(h.Username, h.Password)
+	}
+
+	if h.SigningSecret != "" {
+		req.Header.Set(SignatureHeader, sign(h.SigningSecret, body))
+	}
+
+	return req, nil
+}
+
+func (w *WebhookOutput) Send(name string, alert *engine.Alert) error {
+	log.Debugf("WEBHOOK: %s %s", name, alert.Message)
+
+	hook, ok := w.endpoints[name]
+	if !ok {
+		return &engine.PermanentError{Err: fmt.Errorf("there is no webhook named '%s'", name)}
+	}
+
+	body, err := hook.render(alert)
+	if err != nil {
+		return &engine.PermanentError{Err: fmt.Errorf("error rendering body for webhook %s: %s", name, err)}
+	}
+
+	req, err := hook.request(body)
+	if err != nil {
+		return err
+	}
+
+	return checkResponse(w.client.Do(req))
+}
+
+// checkResponse turns responses other than 2xx into errors, asking to be
+// retried later when the server says how long to wait. Other client errors,
+// like a bad key or a webhook that's gone, won't succeed however often
+// they're retried, so they're permanent. Errors only name the host, as some
+// webhook URLs hold credentials.
+func checkResponse(resp *http.Response, err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		if u, parseErr := url.Parse(urlErr.URL); parseErr == nil {
+			urlErr.URL = u.Scheme + "://" + u.Host
+		}
+		return urlErr
+	} else if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("%s responded %s: %s", resp.Request.URL.Host, resp.Status, bytes.TrimSpace(body))
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		if after := retryAfter(resp.Header.Get("Retry-After")); after > 0 {
+			return &engine.RetryAfterError{After: after, Err: err}
+		}
+	case resp.StatusCode == http.StatusRequestTimeout: // worth trying again
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return &engine.PermanentError{Err: err}
+	}
+	return err
+}
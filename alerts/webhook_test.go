@@ -0,0 +1,173 @@
+package alerts
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/uswitch/klint/engine"
+)
+
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+// webhookServer records what it receives, responding with status.
+func webhookServer(t *testing.T, status int, header http.Header) (*httptest.Server, <-chan received) {
+	t.Helper()
+
+	ch := make(chan received, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ch <- received{header: r.Header, body: body}
+
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, ch
+}
+
+func testAlert() *engine.Alert {
+	return &engine.Alert{
+		Rule:        &engine.Rule{RuleMeta: engine.RuleMeta{Name: "TestRule"}},
+		Message:     `Pod "web" isn't ready`,
+		Object:      engine.ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: "team", Name: "web", UID: "abc"},
+		Severity:    engine.SeverityCritical,
+		Status:      engine.StatusFiring,
+		Fingerprint: "1234",
+	}
+}
+
+func newTestWebhook(t *testing.T, endpoint WebhookEndpoint) *WebhookOutput {
+	t.Helper()
+
+	output, err := NewWebhookOutput(map[string]WebhookEndpoint{"incidents": endpoint})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return output
+}
+
+func TestWebhookSendsAlertAsJSON(t *testing.T) {
+	server, ch := webhookServer(t, http.StatusOK, nil)
+	output := newTestWebhook(t, WebhookEndpoint{URL: server.URL})
+
+	if err := output.Send("incidents", testAlert()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := <-ch
+	if contentType := got.header.Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("unexpected Content-Type %q", contentType)
+	}
+
+	var alert webhookAlert
+	if err := json.Unmarshal(got.body, &alert); err != nil {
+		t.Fatalf("error decoding %s: %s", got.body, err)
+	}
+	if alert.Rule != "TestRule" || alert.Object.Name != "web" || alert.Status != engine.StatusFiring || alert.Fingerprint != "1234" {
+		t.Errorf("unexpected alert %+v", alert)
+	}
+}
+
+func TestWebhookTemplateHeadersAndSigning(t *testing.T) {
+	server, ch := webhookServer(t, http.StatusAccepted, nil)
+	output := newTestWebhook(t, WebhookEndpoint{
+		URL:           server.URL,
+		Headers:       map[string]string{"X-Source": "klint"},
+		Body:          `{"title": {{ json .Message }}, "service": "{{ .Object.Namespace }}"}`,
+		BearerToken:   "token",
+		SigningSecret: "secret",
+	})
+
+	if err := output.Send("incidents", testAlert()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := <-ch
+	if expected := `{"title": "Pod \"web\" isn't ready", "service": "team"}`; string(got.body) != expected {
+		t.Errorf("expected body %s, got %s", expected, got.body)
+	}
+	if source := got.header.Get("X-Source"); source != "klint" {
+		t.Errorf("expected X-Source header, got %q", source)
+	}
+	if auth := got.header.Get("Authorization"); auth != "Bearer token" {
+		t.Errorf("unexpected Authorization %q", auth)
+	}
+	if signature := got.header.Get(SignatureHeader); signature != sign("secret", got.body) {
+		t.Errorf("unexpected signature %q", signature)
+	}
+}
+
+func TestWebhookBasicAuth(t *testing.T) {
+	server, ch := webhookServer(t, http.StatusOK, nil)
+	output := newTestWebhook(t, WebhookEndpoint{URL: server.URL, Username: "klint", Password: "hunter2"})
+
+	if err := output.Send("incidents", testAlert()); err != nil {
+		t.Fatal(err)
+	}
+
+	req := &http.Request{Header: (<-ch).header}
+	if username, password, ok := req.BasicAuth(); !ok || username != "klint" || password != "hunter2" {
+		t.Errorf("unexpected basic auth %q %q", username, password)
+	}
+	if signature := req.Header.Get(SignatureHeader); signature != "" {
+		t.Errorf("expected no signature without a secret, got %q", signature)
+	}
+}
+
+func TestWebhookErrors(t *testing.T) {
+	server, _ := webhookServer(t, http.StatusInternalServerError, nil)
+	output := newTestWebhook(t, WebhookEndpoint{URL: server.URL})
+
+	if err := output.Send("incidents", testAlert()); err == nil {
+		t.Error("expected an error from a 500")
+	}
+	var permanent *engine.PermanentError
+	if err := output.Send("nowhere", testAlert()); !errors.As(err, &permanent) {
+		t.Errorf("expected a permanent error sending to a webhook that isn't configured, got %v", err)
+	}
+
+	if _, err := NewWebhookOutput(map[string]WebhookEndpoint{"broken": {URL: server.URL, Body: "{{ .Message"}}); err == nil {
+		t.Error("expected an error from a broken template")
+	}
+}
+
+func TestWebhookClientErrorsArePermanent(t *testing.T) {
+	for status, permanent := range map[int]bool{
+		http.StatusBadRequest:          true,
+		http.StatusUnauthorized:        true,
+		http.StatusNotFound:            true,
+		http.StatusGone:                true,
+		http.StatusRequestTimeout:      false,
+		http.StatusTooManyRequests:     false,
+		http.StatusInternalServerError: false,
+	} {
+		server, _ := webhookServer(t, status, nil)
+		output := newTestWebhook(t, WebhookEndpoint{URL: server.URL})
+
+		var permanentErr *engine.PermanentError
+		if err := output.Send("incidents", testAlert()); err == nil || errors.As(err, &permanentErr) != permanent {
+			t.Errorf("%d: expected permanent to be %t, got %v", status, permanent, err)
+		}
+	}
+}
+
+func TestWebhookRateLimited(t *testing.T) {
+	server, _ := webhookServer(t, http.StatusTooManyRequests, http.Header{"Retry-After": {"30"}})
+	output := newTestWebhook(t, WebhookEndpoint{URL: server.URL})
+
+	var retry *engine.RetryAfterError
+	if err := output.Send("incidents", testAlert()); !errors.As(err, &retry) || retry.After != 30*time.Second {
+		t.Errorf("expected to be told to retry after 30s, got %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/uswitch/klint/audit"
+)
+
+func runAudit(opts *options) {
+	clientSet, dynamicClient := newClients(opts)
+	engine, _ := newEngine(opts, clientSet, dynamicClient, opts.auditNotify)
+
+	alerts, err := engine.Audit(context.Background(), opts.namespace)
+	if err != nil {
+		log.Fatalf("error auditing cluster: %s", err)
+	}
+
+	audit.NewReport(alerts).Write(os.Stdout)
+
+	if opts.auditNotify {
+		for _, alert := range alerts {
+			engine.Notify(alert)
+		}
+
+		if !engine.WaitForDeliveries(opts.shutdownTimeout) {
+			log.Errorf("gave up waiting for alerts to be sent after %s", opts.shutdownTimeout)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Package audit formats the violations found by engine.Audit into a report
+// grouped by namespace and rule.
+package audit
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"github.com/uswitch/klint/engine"
+)
+
+// Report holds alerts by namespace and then by rule name.
+type Report struct {
+	byNamespace map[string]map[string][]*engine.Alert
+	total       int
+}
+
+func NewReport(alerts []*engine.Alert) *Report {
+	report := &Report{byNamespace: map[string]map[string][]*engine.Alert{}}
+
+	for _, alert := range alerts {
+		report.Add(alert)
+	}
+
+	return report
+}
+
+func (r *Report) Add(alert *engine.Alert) {
+	namespace := "<cluster>"
+	if metaObj, err := meta.Accessor(alert.Resource); err == nil && metaObj.GetNamespace() != "" {
+		namespace = metaObj.GetNamespace()
+	}
+
+	byRule, ok := r.byNamespace[namespace]
+	if !ok {
+		byRule = map[string][]*engine.Alert{}
+		r.byNamespace[namespace] = byRule
+	}
+
+	byRule[alert.Rule.Name] = append(byRule[alert.Rule.Name], alert)
+	r.total++
+}
+
+func kindOf(obj runtime.Object) string {
+	if kind := obj.GetObjectKind().GroupVersionKind().Kind; kind != "" {
+		return kind
+	}
+
+	if gvks, _, err := scheme.Scheme.ObjectKinds(obj); err == nil {
+		return gvks[0].Kind
+	}
+
+	return "Object"
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// Write prints the report to w.
+func (r *Report) Write(w io.Writer) {
+	for _, namespace := range sortedKeys(r.byNamespace) {
+		fmt.Fprintf(w, "%s\n", namespace)
+
+		byRule := r.byNamespace[namespace]
+		for _, rule := range sortedKeys(byRule) {
+			alerts := byRule[rule]
+			fmt.Fprintf(w, "  %s [%s] (%d)\n", rule, alerts[0].Rule.Severity, len(alerts))
+
+			for _, alert := range alerts {
+				name, _ := meta.NewAccessor().Name(alert.Resource)
+				message := strings.ReplaceAll(alert.Message, "\n", "\n      ")
+				fmt.Fprintf(w, "    - %s %s: %s\n", kindOf(alert.Resource), name, message)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "\n%d violations in %d namespaces\n", r.total, len(r.byNamespace))
+}
@@ -0,0 +1,55 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/uswitch/klint/engine"
+	"github.com/uswitch/klint/rules"
+)
+
+func TestAuditReportsOldObjects(t *testing.T) {
+	longAgo := metav1.NewTime(time.Now().Add(-365 * 24 * time.Hour))
+
+	client := fake.NewSimpleClientset(
+		&networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "frontend", CreationTimestamp: longAgo}},
+		&networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "backend", CreationTimestamp: longAgo}},
+		&networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "admin", Namespace: "backend"}},
+	)
+
+	e := engine.NewEngine(client, nil)
+	e.AddRule(rules.IngressNeedsAnnotation)
+
+	alerts, err := e.Audit(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	NewReport(alerts).Write(out)
+
+	expected := []string{
+		"backend",
+		"  IngressNeedsAnnotation [info] (2)",
+		"frontend",
+		"  IngressNeedsAnnotation [info] (1)",
+		"3 violations in 2 namespaces",
+	}
+
+	report := out.String()
+	last := 0
+	for _, line := range expected {
+		i := strings.Index(report[last:], line)
+		if i < 0 {
+			t.Fatalf("expected %q in order in report:\n%s", line, report)
+		}
+		last += i + len(line)
+	}
+}
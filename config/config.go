@@ -0,0 +1,185 @@
+// Package config loads klint's configuration file, which says which rules
+// are enabled and how they're parameterised.
+package config
+
+import (
+	"encoding/json"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the root of the configuration file, e.g.
+//
+//	rules:
+//	  IngressNeedsAnnotation:
+//	    enabled: false
+//	  RequireCronJobHistoryLimits:
+//	    params:
+//	      maxHistoryLimit: 5
+//	celRules:
+//	- name: DeploymentsNeedTwoReplicas
+//	  resource:
+//	    apiVersion: apps/v1
+//	    kind: Deployment
+//	  expression: object.spec.replicas >= 2
+//	  message: "{{ .object.metadata.name }} should run at least 2 replicas"
+//	repeat:
+//	  severities:
+//	    critical: 4h
+//	outputs:
+//	  sns:
+//	    enabled: false
+//	  webhooks:
+//	    incidents:
+//	      url: https://incidents.example.com/klint
+//	      bearerTokenEnv: INCIDENTS_TOKEN
+type Config struct {
+	Rules    map[string]RuleConfig `json:"rules,omitempty"`
+	CELRules []CELRule             `json:"celRules,omitempty"`
+	Repeat   RepeatConfig          `json:"repeat,omitempty"`
+	Outputs  OutputsConfig         `json:"outputs,omitempty"`
+}
+
+// RuleConfig configures a single rule. Rules are enabled unless they're
+// explicitly disabled. Params are decoded by the rule itself.
+type RuleConfig struct {
+	Enabled *bool           `json:"enabled,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+func (c RuleConfig) IsEnabled() bool { return enabled(c.Enabled) }
+
+// CELRule is a rule written as a CEL expression rather than in Go. The
+// expression is given the object as object, and the object it replaced as
+// oldObject (null when it's new), and should be true when the object is
+// fine. Objects are only checked if every match condition is true. Message
+// is a text/template given the same variables.
+type CELRule struct {
+	Name            string           `json:"name"`
+	Description     string           `json:"description,omitempty"`
+	Severity        string           `json:"severity,omitempty"`
+	DocsURL         string           `json:"docsURL,omitempty"`
+	Resource        Resource         `json:"resource"`
+	MatchConditions []MatchCondition `json:"matchConditions,omitempty"`
+	Expression      string           `json:"expression"`
+	Message         string           `json:"message,omitempty"`
+}
+
+// MatchCondition is a CEL expression that limits which objects a CEL rule
+// checks. The name is only used in errors.
+type MatchCondition struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+}
+
+// Resource identifies the objects a CEL rule is evaluated against. The
+// plural resource name is guessed from Kind if it isn't given.
+type Resource struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Resource   string `json:"resource,omitempty"`
+}
+
+// RepeatConfig says how often violations that are still firing are sent
+// again, by rule name or by severity, overriding --repeat-interval. 0 means
+// they're only sent once.
+type RepeatConfig struct {
+	Severities map[string]metav1.Duration `json:"severities,omitempty"`
+	Rules      map[string]metav1.Duration `json:"rules,omitempty"`
+}
+
+// OutputsConfig configures the outputs. Credentials are still given with
+// flags or environment variables, so they don't end up in the config.
+type OutputsConfig struct {
+	Slack      SlackConfig              `json:"slack,omitempty"`
+	SNS        SNSConfig                `json:"sns,omitempty"`
+	PagerDuty  PagerDutyConfig          `json:"pagerduty,omitempty"`
+	Opsgenie   OpsgenieConfig           `json:"opsgenie,omitempty"`
+	MSTeams    ChatConfig               `json:"msteams,omitempty"`
+	GoogleChat ChatConfig               `json:"googlechat,omitempty"`
+	Webhooks   map[string]WebhookConfig `json:"webhooks,omitempty"`
+}
+
+// SlackConfig is enabled by default if a token is given.
+type SlackConfig struct {
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+// SNSConfig is enabled by default. Region overrides --aws-region.
+type SNSConfig struct {
+	Enabled *bool  `json:"enabled,omitempty"`
+	Region  string `json:"region,omitempty"`
+}
+
+// PagerDutyConfig names the services alerts can be sent to. Their integration
+// keys are credentials, so they're read from environment variables. URL
+// overrides the Events API v2 endpoint, e.g. for the EU.
+type PagerDutyConfig struct {
+	Enabled  *bool                             `json:"enabled,omitempty"`
+	URL      string                            `json:"url,omitempty"`
+	Services map[string]PagerDutyServiceConfig `json:"services,omitempty"`
+}
+
+type PagerDutyServiceConfig struct {
+	RoutingKeyEnv string `json:"routingKeyEnv"`
+}
+
+// OpsgenieConfig is enabled by default if an API key is given. URL overrides
+// the API's, e.g. for the EU.
+type OpsgenieConfig struct {
+	Enabled *bool  `json:"enabled,omitempty"`
+	URL     string `json:"url,omitempty"`
+}
+
+// ChatConfig names the incoming webhooks a chat output can post to. Their
+// URLs hold credentials, so they're read from environment variables.
+type ChatConfig struct {
+	Webhooks map[string]ChatWebhookConfig `json:"webhooks,omitempty"`
+}
+
+type ChatWebhookConfig struct {
+	URLEnv string `json:"urlEnv"`
+}
+
+// WebhookConfig is an endpoint alerts are POSTed to, chosen by its name in
+// the webhook annotation. Body is a text/template given the alert, and
+// defaults to the alert as JSON. Secrets are named by the environment
+// variables holding them.
+type WebhookConfig struct {
+	URL              string            `json:"url"`
+	Headers          map[string]string `json:"headers,omitempty"`
+	Body             string            `json:"body,omitempty"`
+	BearerTokenEnv   string            `json:"bearerTokenEnv,omitempty"`
+	BasicAuth        *BasicAuthConfig  `json:"basicAuth,omitempty"`
+	SigningSecretEnv string            `json:"signingSecretEnv,omitempty"`
+}
+
+type BasicAuthConfig struct {
+	Username    string `json:"username"`
+	PasswordEnv string `json:"passwordEnv"`
+}
+
+func enabled(b *bool) bool {
+	return b == nil || *b
+}
+
+func (c SlackConfig) IsEnabled() bool { return enabled(c.Enabled) }
+
+func (c SNSConfig) IsEnabled() bool { return enabled(c.Enabled) }
+
+func (c PagerDutyConfig) IsEnabled() bool { return enabled(c.Enabled) }
+
+func (c OpsgenieConfig) IsEnabled() bool { return enabled(c.Enabled) }
+
+// Parse decodes a YAML or JSON configuration, rejecting unknown fields.
+func Parse(data []byte) (*Config, error) {
+	config := &Config{}
+
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// WatchFile checks path every interval and calls onChange with its contents
+// when they differ from the last contents seen, starting with current. It
+// returns when ctx is done.
+func WatchFile(ctx context.Context, path string, current []byte, interval time.Duration, onChange func([]byte)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			data, err := os.ReadFile(path)
+			if err != nil {
+				log.Errorf("error reading config %s: %s", path, err)
+				continue
+			}
+
+			if !bytes.Equal(data, current) {
+				log.Infof("config %s has changed", path)
+				current = data
+				onChange(data)
+			}
+		}
+	}
+}
+
+func configMapListWatch(client kubernetes.Interface, namespace, name string) cache.ListerWatcher {
+	selector := fields.OneTermEqualSelector("metadata.name", name).String()
+
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = selector
+			return client.CoreV1().ConfigMaps(namespace).List(context.TODO(), options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = selector
+			return client.CoreV1().ConfigMaps(namespace).Watch(context.TODO(), options)
+		},
+	}
+}
+
+// LoadConfigMap reads key from the ConfigMap.
+func LoadConfigMap(ctx context.Context, client kubernetes.Interface, namespace, name, key string) ([]byte, error) {
+	configMap, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := configMap.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("ConfigMap %s/%s has no key %s", namespace, name, key)
+	}
+
+	return []byte(data), nil
+}
+
+// WatchConfigMap calls onChange with the value of key in the ConfigMap when
+// it differs from the last value seen, starting with current. It returns
+// when ctx is done.
+func WatchConfigMap(ctx context.Context, client kubernetes.Interface, namespace, name, key string, current []byte, onChange func([]byte)) {
+	changes := make(chan []byte)
+
+	handle := func(obj interface{}) {
+		if configMap, ok := obj.(*v1.ConfigMap); ok {
+			if data, ok := configMap.Data[key]; ok {
+				select {
+				case changes <- []byte(data):
+				case <-ctx.Done():
+				}
+			} else {
+				log.Errorf("ConfigMap %s/%s has no key %s", namespace, name, key)
+			}
+		}
+	}
+
+	_, informer := cache.NewInformer(configMapListWatch(client, namespace, name), &v1.ConfigMap{}, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc:    handle,
+		UpdateFunc: func(_, new interface{}) { handle(new) },
+	})
+	go informer.Run(ctx.Done())
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case data := <-changes:
+			if !bytes.Equal(data, current) {
+				log.Infof("ConfigMap %s/%s has changed", namespace, name)
+				current = data
+				onChange(data)
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	initial := []byte("rules: {}\n")
+
+	if err := os.WriteFile(path, initial, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan string, 10)
+	go WatchFile(ctx, path, initial, 10*time.Millisecond, func(data []byte) { changes <- string(data) })
+
+	select {
+	case data := <-changes:
+		t.Fatalf("unexpected change %q", data)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	updated := "rules:\n  IngressNeedsAnnotation:\n    enabled: false\n"
+	if err := os.WriteFile(path, []byte(updated), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case data := <-changes:
+		if data != updated {
+			t.Fatalf("expected %q, got %q", updated, data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for change")
+	}
+}
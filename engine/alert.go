@@ -0,0 +1,127 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// Output delivers alerts somewhere people will see them. target is the value
+// of the output's annotation on the object or its namespace, e.g. a Slack
+// channel or an SNS topic.
+type Output interface {
+	Key() string
+	Send(target string, alert *Alert) error
+}
+
+type Status string
+
+const (
+	StatusFiring   Status = "firing"
+	StatusResolved Status = "resolved"
+)
+
+// ObjectReference identifies the object an alert is about.
+type ObjectReference struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Name       string    `json:"name"`
+	UID        types.UID `json:"uid"`
+}
+
+func (r ObjectReference) String() string {
+	if r.Namespace == "" {
+		return fmt.Sprintf("%s/%s", r.Kind, r.Name)
+	}
+	return fmt.Sprintf("%s/%s/%s", r.Kind, r.Namespace, r.Name)
+}
+
+func groupVersionKind(obj runtime.Object) schema.GroupVersionKind {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	if gvk.Kind == "" { // typed objects from informers don't have their TypeMeta set
+		if gvks, _, err := scheme.Scheme.ObjectKinds(obj); err == nil {
+			gvk = gvks[0]
+		}
+	}
+	return gvk
+}
+
+func objectReference(obj runtime.Object) ObjectReference {
+	ref := ObjectReference{}
+	ref.APIVersion, ref.Kind = groupVersionKind(obj).ToAPIVersionAndKind()
+
+	if metaObj, err := meta.Accessor(obj); err == nil {
+		ref.Namespace = metaObj.GetNamespace()
+		ref.Name = metaObj.GetName()
+		ref.UID = metaObj.GetUID()
+	}
+
+	return ref
+}
+
+// fingerprint identifies the rule, object and violation an alert is about,
+// so that outputs can group or de-duplicate alerts across messages.
+func fingerprint(rule *Rule, ref ObjectReference, key string) string {
+	id := ""
+	if rule != nil {
+		id = rule.Id
+	}
+
+	ident := fmt.Sprintf("%s:%s", id, ref.UID)
+	if key != "" {
+		ident = fmt.Sprintf("%s:%s", ident, key)
+	}
+
+	sum := sha256.Sum256([]byte(ident))
+	return hex.EncodeToString(sum[:8])
+}
+
+type Alert struct {
+	Rule     *Rule
+	Resource runtime.Object
+	Message  string
+
+	Object   ObjectReference
+	Severity Severity
+	// Key tells apart the violations of a rule by one object. It's empty
+	// for rules that only report one thing wrong with each object.
+	Key         string
+	Fingerprint string
+	Status      Status
+}
+
+func NewAlert(resource runtime.Object, message string) *Alert {
+	return &Alert{
+		Resource: resource,
+		Message:  message,
+		Object:   objectReference(resource),
+		Status:   StatusFiring,
+	}
+}
+
+// Resolved reports whether the alert is telling people a problem was fixed.
+func (a *Alert) Resolved() bool {
+	return a.Status == StatusResolved
+}
+
+// Text is the message followed by a line saying which rule raised it and
+// where to read about fixing it, for outputs that only deal in text.
+func (a *Alert) Text() string {
+	if a.Rule == nil {
+		return a.Message
+	}
+
+	footer := fmt.Sprintf("`%s` (%s)", a.Rule.Name, a.Severity)
+	if a.Rule.DocsURL != "" {
+		footer = fmt.Sprintf("%s %s", footer, a.Rule.DocsURL)
+	}
+
+	return fmt.Sprintf("%s\n%s", a.Message, footer)
+}
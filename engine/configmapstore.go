@@ -0,0 +1,175 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	configMapStoreKey = "state.json"
+	// ConfigMaps can hold 1MiB, leave room for the rest of the object
+	maxConfigMapStoreBytes = 900 * 1024
+)
+
+// ConfigMapStore is a MemoryStore that's saved to a ConfigMap, so that
+// alerts aren't sent again when klint restarts. Changes are written every
+// so often by Run rather than as they happen.
+type ConfigMapStore struct {
+	*MemoryStore
+
+	client    kubernetes.Interface
+	namespace string
+	name      string
+
+	mu    sync.Mutex
+	dirty bool
+	// flushing is held while writing, so that writes don't race each other
+	flushing sync.Mutex
+}
+
+func NewConfigMapStore(client kubernetes.Interface, namespace, name string, size int, ttl time.Duration) *ConfigMapStore {
+	return &ConfigMapStore{
+		MemoryStore: NewMemoryStore(size, ttl),
+		client:      client,
+		namespace:   namespace,
+		name:        name,
+	}
+}
+
+func (s *ConfigMapStore) Set(uid types.UID, records map[string]Record) {
+	s.MemoryStore.Set(uid, records)
+	s.markDirty()
+}
+
+func (s *ConfigMapStore) Delete(uid types.UID) {
+	s.MemoryStore.Delete(uid)
+	s.markDirty()
+}
+
+func (s *ConfigMapStore) markDirty() {
+	s.mu.Lock()
+	s.dirty = true
+	s.mu.Unlock()
+}
+
+// Load reads what was saved to the ConfigMap, if it exists.
+func (s *ConfigMapStore) Load(ctx context.Context) error {
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	data, ok := cm.Data[configMapStoreKey]
+	if !ok {
+		return nil
+	}
+
+	entries := []storeEntry{}
+	if err := json.Unmarshal([]byte(data), &entries); err != nil {
+		return err
+	}
+
+	s.restore(entries)
+	log.Infof("Loaded %d objects' alerts from ConfigMap %s/%s", len(entries), s.namespace, s.name)
+
+	return nil
+}
+
+// encodeEntries returns the entries as JSON, dropping the least recently used
+// until they fit in a ConfigMap.
+func encodeEntries(entries []storeEntry) ([]byte, error) {
+	for {
+		data, err := json.Marshal(entries)
+		if err != nil || len(data) <= maxConfigMapStoreBytes {
+			return data, err
+		}
+
+		keep := len(entries) * 9 / 10
+		if keep == len(entries) {
+			keep--
+		}
+		log.Warnf("Too many alerts to save to a ConfigMap, forgetting the %d least recently seen objects", len(entries)-keep)
+		entries = entries[:keep]
+	}
+}
+
+// Flush writes the store to the ConfigMap if it has changed since it was
+// last written, creating the ConfigMap if needed.
+func (s *ConfigMapStore) Flush(ctx context.Context) error {
+	s.flushing.Lock()
+	defer s.flushing.Unlock()
+
+	s.mu.Lock()
+	dirty := s.dirty
+	s.dirty = false
+	s.mu.Unlock()
+
+	if !dirty {
+		return nil
+	}
+
+	data, err := encodeEntries(s.snapshot())
+	if err == nil {
+		err = s.write(ctx, string(data))
+	}
+	if err != nil {
+		s.markDirty() // try again next time
+	}
+
+	return err
+}
+
+func (s *ConfigMapStore) write(ctx context.Context, data string) error {
+	configMaps := s.client.CoreV1().ConfigMaps(s.namespace)
+
+	cm, err := configMaps.Get(ctx, s.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		cm = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: s.name, Namespace: s.namespace},
+			Data:       map[string]string{configMapStoreKey: data},
+		}
+		_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[configMapStoreKey] = data
+
+	_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	return err
+}
+
+// Run flushes the store every interval until ctx is done. It doesn't flush
+// once more when it stops, as that may be because another replica has taken
+// over saving it; Flush should be called when klint stops instead.
+func (s *ConfigMapStore) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Flush(ctx); err != nil {
+				log.Errorf("error saving alerts to ConfigMap %s/%s: %s", s.namespace, s.name, err)
+			}
+		}
+	}
+}
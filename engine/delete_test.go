@@ -0,0 +1,53 @@
+package engine_test
+
+import (
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/uswitch/klint/engine"
+	"github.com/uswitch/klint/engine/enginetest"
+)
+
+func TestDeleteResolvesAlerts(t *testing.T) {
+	h := enginetest.New(t, alwaysAlert("ingresses", engine.WantIngress))
+
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "web", UID: "web"}}
+	h.Create(ingress)
+	h.WaitForAlerts(1)
+
+	h.Delete(ingress)
+
+	alerts := h.WaitForAlerts(1)
+	if !alerts[0].Alert.Resolved() || alerts[0].Alert.Message != "Ingress/klint-test/web was deleted" {
+		t.Fatalf("expected a resolved alert, got %v", alerts[0].Alert)
+	}
+
+	// it's forgotten, so a new object with the same name alerts again
+	h.Create(ingress)
+	h.WaitForAlerts(1)
+}
+
+func TestDeleteHandler(t *testing.T) {
+	rule := alwaysAlert("ingresses", engine.WantIngress)
+	rule.DeleteHandler = func(obj runtime.Object, ctx *engine.RuleHandlerContext) {
+		ctx.Resolvef(obj, "Thanks for tidying up %s", obj.(*networkingv1.Ingress).Name)
+	}
+
+	h := enginetest.New(t, rule)
+
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "web", UID: "web"}}
+	h.Create(ingress)
+	h.WaitForAlerts(1)
+
+	h.Delete(ingress)
+
+	// the rule resolved its own alert, so the engine doesn't too
+	alerts := h.WaitForAlerts(1)
+	if !alerts[0].Alert.Resolved() || alerts[0].Alert.Message != "Thanks for tidying up web" {
+		t.Fatalf("expected the delete handler's resolution, got %v", alerts[0].Alert)
+	}
+	h.ExpectNoAlerts()
+}
@@ -0,0 +1,248 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RetryAfterError is returned by outputs that have been told how long to
+// wait before trying again, e.g. when they've been rate limited.
+type RetryAfterError struct {
+	After time.Duration
+	Err   error
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", e.Err, e.After)
+}
+
+func (e *RetryAfterError) Unwrap() error { return e.Err }
+
+// PermanentError is returned by outputs when trying again won't help, e.g.
+// when they're asked to send to a target they don't know about.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// DeliveryPolicy says how hard to try to send an alert to an output. Waits
+// between attempts double from Backoff up to MaxBackoff, unless the output
+// returns a RetryAfterError.
+type DeliveryPolicy struct {
+	Attempts   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+var DefaultDeliveryPolicy = DeliveryPolicy{
+	Attempts:   5,
+	Backoff:    time.Second,
+	MaxBackoff: time.Minute,
+}
+
+// deliveryBuffer is how many alerts can wait for each output's target before
+// they're given up on.
+const deliveryBuffer = 1000
+
+func (p DeliveryPolicy) wait(attempt int, err error) time.Duration {
+	var retry *RetryAfterError
+	if errors.As(err, &retry) && retry.After > 0 {
+		return retry.After
+	}
+
+	wait := p.Backoff
+	for i := 1; i < attempt && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	return wait
+}
+
+// DeadLetter records alerts that couldn't be sent to an output.
+type DeadLetter interface {
+	Write(output string, target string, alert *Alert, err error)
+}
+
+type deadLetterRecord struct {
+	Time        time.Time       `json:"time"`
+	Output      string          `json:"output"`
+	Target      string          `json:"target"`
+	Error       string          `json:"error"`
+	Rule        string          `json:"rule,omitempty"`
+	Severity    Severity        `json:"severity"`
+	Status      Status          `json:"status"`
+	Object      ObjectReference `json:"object"`
+	Key         string          `json:"key,omitempty"`
+	Fingerprint string          `json:"fingerprint"`
+	Message     string          `json:"message"`
+}
+
+// JSONDeadLetter writes each alert that couldn't be sent as a line of JSON.
+type JSONDeadLetter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewJSONDeadLetter(w io.Writer) *JSONDeadLetter {
+	return &JSONDeadLetter{w: w}
+}
+
+func (d *JSONDeadLetter) Write(output string, target string, alert *Alert, err error) {
+	record := deadLetterRecord{
+		Time:        time.Now(),
+		Output:      output,
+		Target:      target,
+		Error:       err.Error(),
+		Severity:    alert.Severity,
+		Status:      alert.Status,
+		Object:      alert.Object,
+		Key:         alert.Key,
+		Fingerprint: alert.Fingerprint,
+		Message:     alert.Message,
+	}
+	if alert.Rule != nil {
+		record.Rule = alert.Rule.Name
+	}
+
+	data, _ := json.Marshal(record)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, err := d.w.Write(append(data, '\n')); err != nil {
+		log.Errorf("error writing dead letter: %s", err)
+	}
+}
+
+// destination is where an alert is sent: an output's key and the target
+// named by the annotation.
+type destination struct {
+	output string
+	target string
+}
+
+// SetDeliveryPolicy sets how hard to try sending alerts. It should be
+// called before anything is sent.
+func (e *Engine) SetDeliveryPolicy(policy DeliveryPolicy) {
+	e.deliveryPolicy = policy
+}
+
+// SetDeadLetter sets where alerts that couldn't be sent are written. They're
+// only logged without one. It should be called before anything is sent.
+func (e *Engine) SetDeadLetter(deadLetter DeadLetter) {
+	e.deadLetter = deadLetter
+}
+
+// deliver queues alert to be sent to target by the output with key. Each
+// target has its own queue, so one that's slow or failing doesn't hold up
+// the others, even on the same output.
+func (e *Engine) deliver(key string, target string, alert *Alert) {
+	dest := destination{output: key, target: target}
+
+	e.deliveryMu.Lock()
+	defer e.deliveryMu.Unlock()
+
+	queue, ok := e.deliveries[dest]
+	if !ok {
+		queue = make(chan *Alert, deliveryBuffer)
+		e.deliveries[dest] = queue
+		go e.deliverTo(dest, queue)
+	}
+
+	select {
+	case queue <- alert:
+		e.delivering.Add(1)
+	default:
+		e.failed(key, target, alert, fmt.Errorf("too many alerts waiting to be sent"))
+	}
+}
+
+// deliverTo sends what's queued for dest, stopping once it's caught up so
+// that targets that are no longer used don't keep a goroutine each.
+func (e *Engine) deliverTo(dest destination, queue chan *Alert) {
+	for {
+		e.deliveryMu.Lock()
+		if len(queue) == 0 {
+			delete(e.deliveries, dest)
+			e.deliveryMu.Unlock()
+			return
+		}
+		e.deliveryMu.Unlock()
+
+		e.sendWithRetries(dest.output, dest.target, <-queue)
+		e.delivering.Done()
+	}
+}
+
+// sendWithRetries tries sending alert to target until it's sent or the
+// delivery policy says to give up.
+func (e *Engine) sendWithRetries(key string, target string, alert *Alert) {
+	start := time.Now()
+	policy := e.deliveryPolicy
+
+	for attempt := 1; ; attempt++ {
+		e.mu.RLock()
+		output, ok := e.outputs[key]
+		e.mu.RUnlock()
+
+		if !ok {
+			e.failed(key, target, alert, fmt.Errorf("there is no output '%s'", key))
+			return
+		}
+
+		err := output.Send(target, alert)
+		if err == nil {
+			outputSends.WithLabelValues(key, "sent").Inc()
+			deliveryDuration.WithLabelValues(key).Observe(time.Since(start).Seconds())
+			return
+		}
+
+		var permanent *PermanentError
+		if attempt >= policy.Attempts || errors.As(err, &permanent) {
+			e.failed(key, target, alert, err)
+			return
+		}
+
+		wait := policy.wait(attempt, err)
+		outputSends.WithLabelValues(key, "retried").Inc()
+		log.Warnf("error sending alert to %s %s, retrying in %s: %s", key, target, wait, err)
+		time.Sleep(wait)
+	}
+}
+
+func (e *Engine) failed(key string, target string, alert *Alert, err error) {
+	outputSends.WithLabelValues(key, "failed").Inc()
+	log.Errorf("gave up sending alert to %s %s: %s", key, target, err)
+
+	if e.deadLetter != nil {
+		e.deadLetter.Write(key, target, alert, err)
+	}
+}
+
+// WaitForDeliveries waits up to timeout for every alert that's been notified
+// to be sent or given up on, returning false if they weren't.
+func (e *Engine) WaitForDeliveries(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		e.delivering.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
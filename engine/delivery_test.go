@@ -0,0 +1,179 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// flakyOutput fails its first few sends, as many as failures.
+type flakyOutput struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+}
+
+func (f *flakyOutput) Key() string { return "flaky" }
+
+func (f *flakyOutput) Send(target string, alert *Alert) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.attempts++
+	if f.attempts <= f.failures {
+		return fmt.Errorf("attempt %d failed", f.attempts)
+	}
+	return nil
+}
+
+func (f *flakyOutput) tried() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.attempts
+}
+
+func newDeliveryEngine(output Output) (*Engine, *bytes.Buffer) {
+	deadLetters := &bytes.Buffer{}
+
+	e := NewEngine(fake.NewSimpleClientset(), nil)
+	e.AddOutput(output)
+	e.SetDeliveryPolicy(DeliveryPolicy{Attempts: 3, Backoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond})
+	e.SetDeadLetter(NewJSONDeadLetter(deadLetters))
+
+	return e, deadLetters
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	output := &flakyOutput{failures: 2}
+	e, deadLetters := newDeliveryEngine(output)
+
+	e.deliver("flaky", "channel", &Alert{Message: "hello"})
+	if !e.WaitForDeliveries(time.Second) {
+		t.Fatal("alert wasn't delivered")
+	}
+
+	if tried := output.tried(); tried != 3 {
+		t.Errorf("expected 3 attempts, got %d", tried)
+	}
+	if deadLetters.Len() != 0 {
+		t.Errorf("expected nothing to be dead lettered, got %s", deadLetters)
+	}
+}
+
+func TestDeliveryDeadLetters(t *testing.T) {
+	output := &flakyOutput{failures: 10}
+	e, deadLetters := newDeliveryEngine(output)
+
+	e.deliver("flaky", "channel", &Alert{Message: "hello", Severity: SeverityWarning, Status: StatusFiring, Fingerprint: "abc"})
+	if !e.WaitForDeliveries(time.Second) {
+		t.Fatal("alert wasn't given up on")
+	}
+
+	if tried := output.tried(); tried != 3 {
+		t.Errorf("expected 3 attempts, got %d", tried)
+	}
+
+	var record deadLetterRecord
+	if err := json.Unmarshal(deadLetters.Bytes(), &record); err != nil {
+		t.Fatalf("error reading dead letter %q: %s", deadLetters, err)
+	}
+	if record.Output != "flaky" || record.Target != "channel" || record.Message != "hello" || record.Fingerprint != "abc" {
+		t.Errorf("unexpected dead letter %+v", record)
+	}
+	if record.Error != "attempt 3 failed" {
+		t.Errorf("expected the last error to be dead lettered, got %q", record.Error)
+	}
+}
+
+// targetedOutput fails sending to unknown, and holds sends to blocked until
+// it's closed.
+type targetedOutput struct {
+	blocked chan struct{}
+	sent    chan string
+}
+
+func (o *targetedOutput) Key() string { return "targeted" }
+
+func (o *targetedOutput) Send(target string, alert *Alert) error {
+	switch target {
+	case "unknown":
+		return &PermanentError{Err: fmt.Errorf("there is no target named '%s'", target)}
+	case "blocked":
+		<-o.blocked
+	}
+	o.sent <- target
+	return nil
+}
+
+func TestDeliveryDoesntRetryPermanentErrors(t *testing.T) {
+	output := &targetedOutput{sent: make(chan string, 1)}
+	e, deadLetters := newDeliveryEngine(output)
+	e.SetDeliveryPolicy(DeliveryPolicy{Attempts: 3, Backoff: time.Hour, MaxBackoff: time.Hour})
+
+	e.deliver("targeted", "unknown", &Alert{Message: "hello"})
+	if !e.WaitForDeliveries(time.Second) {
+		t.Fatal("alert was retried")
+	}
+
+	var record deadLetterRecord
+	if err := json.Unmarshal(deadLetters.Bytes(), &record); err != nil {
+		t.Fatalf("error reading dead letter %q: %s", deadLetters, err)
+	}
+	if record.Target != "unknown" || record.Error != "there is no target named 'unknown'" {
+		t.Errorf("unexpected dead letter %+v", record)
+	}
+}
+
+func TestDeliveryTargetsDontHoldEachOtherUp(t *testing.T) {
+	output := &targetedOutput{blocked: make(chan struct{}), sent: make(chan string, 2)}
+	e, _ := newDeliveryEngine(output)
+
+	e.deliver("targeted", "blocked", &Alert{Message: "hello"})
+	e.deliver("targeted", "channel", &Alert{Message: "hello"})
+
+	select {
+	case target := <-output.sent:
+		if target != "channel" {
+			t.Errorf("expected channel to be sent to first, got %s", target)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("alert was held up by another target")
+	}
+
+	close(output.blocked)
+	if !e.WaitForDeliveries(time.Second) {
+		t.Fatal("alerts weren't delivered")
+	}
+}
+
+func TestDeliveryPolicyWait(t *testing.T) {
+	policy := DeliveryPolicy{Attempts: 10, Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	failed := fmt.Errorf("failed")
+
+	tests := []struct {
+		attempt int
+		err     error
+		wait    time.Duration
+	}{
+		{1, failed, time.Second},
+		{2, failed, 2 * time.Second},
+		{3, failed, 4 * time.Second},
+		{4, failed, 5 * time.Second},
+		{9, failed, 5 * time.Second},
+		{1, &RetryAfterError{After: 30 * time.Second, Err: failed}, 30 * time.Second},
+		{3, &RetryAfterError{Err: failed}, 4 * time.Second},
+		{1, fmt.Errorf("wrapped: %w", &RetryAfterError{After: 30 * time.Second, Err: failed}), 30 * time.Second},
+	}
+
+	for _, test := range tests {
+		if wait := policy.wait(test.attempt, test.err); wait != test.wait {
+			t.Errorf("attempt %d after %q: expected to wait %s, got %s", test.attempt, test.err, test.wait, wait)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+)
+
+// WantResource wants objects of any resource, including custom resources,
+// watched through the dynamic client. Rules are handed
+// *unstructured.Unstructured objects. kind is the resource's Kind, e.g.
+//
+//	WantResource(schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}, "StatefulSet")
+func WantResource(gvr schema.GroupVersionResource, kind string) Want {
+	name := fmt.Sprintf("%s.%s", gvr.Resource, gvr.Version)
+	if gvr.Group != "" {
+		name = fmt.Sprintf("%s.%s", name, gvr.Group)
+	}
+
+	return Want{
+		Name:     name,
+		Object:   &unstructured.Unstructured{},
+		Resource: gvr,
+		Kind:     kind,
+	}
+}
+
+// IsDynamic reports whether the Want is watched through the dynamic client.
+func (w Want) IsDynamic() bool {
+	return w.ListWatch == nil
+}
+
+func (w Want) groupVersionKind() schema.GroupVersionKind {
+	return w.Resource.GroupVersion().WithKind(w.Kind)
+}
+
+func dynamicListWatch(client dynamic.Interface, gvr schema.GroupVersionResource, namespace string) cache.ListerWatcher {
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return client.Resource(gvr).Namespace(namespace).List(context.TODO(), options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return client.Resource(gvr).Namespace(namespace).Watch(context.TODO(), options)
+		},
+	}
+}
+
+func (e *Engine) listWatch(want Want, namespace string) cache.ListerWatcher {
+	if want.IsDynamic() {
+		return dynamicListWatch(e.dynamicClient, want.Resource, namespace)
+	}
+	return want.ListWatch(e.clientSet, namespace)
+}
+
+// Accept returns obj in the form rules wanting w expect, converting typed
+// objects to unstructured ones for dynamic Wants, or false if obj isn't
+// something w wants.
+func (w Want) Accept(obj runtime.Object) (runtime.Object, bool) {
+	if !w.IsDynamic() {
+		return obj, reflect.TypeOf(obj) == reflect.TypeOf(w.Object)
+	}
+
+	if groupVersionKind(obj) != w.groupVersionKind() {
+		return nil, false
+	}
+
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u, true
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, false
+	}
+
+	u := &unstructured.Unstructured{Object: content}
+	u.SetGroupVersionKind(w.groupVersionKind())
+
+	return u, true
+}
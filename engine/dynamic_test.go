@@ -0,0 +1,85 @@
+package engine_test
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/uswitch/klint/engine"
+	"github.com/uswitch/klint/engine/enginetest"
+)
+
+var wantCertificates = engine.WantResource(
+	schema.GroupVersionResource{Group: "cert-manager.io", Version: "v1", Resource: "certificates"},
+	"Certificate",
+)
+
+var wantStatefulSets = engine.WantResource(
+	schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"},
+	"StatefulSet",
+)
+
+// certificateNeedsSecret alerts on certificates that don't name a secret
+var certificateNeedsSecret = engine.NewRule(
+	engine.RuleMeta{Name: "CertificateNeedsSecret"},
+	func(_ runtime.Object, new runtime.Object, ctx *engine.RuleHandlerContext) {
+		certificate := new.(*unstructured.Unstructured)
+
+		if name, _, _ := unstructured.NestedString(certificate.Object, "spec", "secretName"); name == "" {
+			ctx.Alertf(new, "Certificate %s has no secretName", certificate.GetName())
+		}
+	},
+	wantCertificates,
+)
+
+func certificate(name string, spec map[string]interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	u.SetAPIVersion("cert-manager.io/v1")
+	u.SetKind("Certificate")
+	u.SetName(name)
+	u.SetUID(types.UID(name))
+	return u
+}
+
+func TestDynamicWant(t *testing.T) {
+	h := enginetest.New(t, certificateNeedsSecret)
+
+	h.Create(certificate("good", map[string]interface{}{"secretName": "tls"}))
+	h.Create(certificate("bad", map[string]interface{}{}))
+
+	alerts := h.WaitForAlerts(1)
+	if alerts[0].Alert.Message != "Certificate bad has no secretName" {
+		t.Fatalf("unexpected alert %q", alerts[0].Alert.Message)
+	}
+	if ref := alerts[0].Alert.Object; ref.Kind != "Certificate" || ref.APIVersion != "cert-manager.io/v1" {
+		t.Fatalf("unexpected object reference %v", ref)
+	}
+
+	h.ExpectNoAlerts()
+}
+
+func TestDynamicWantAcceptsTypedObjects(t *testing.T) {
+	var handled runtime.Object
+	rule := engine.NewRule(
+		engine.RuleMeta{Name: "StatefulSets"},
+		func(_ runtime.Object, new runtime.Object, _ *engine.RuleHandlerContext) { handled = new },
+		wantStatefulSets,
+	)
+
+	engine.Evaluate([]*engine.Rule{rule}, nil, nil, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web"}})
+	if handled != nil {
+		t.Fatal("expected Deployments to be ignored")
+	}
+
+	engine.Evaluate([]*engine.Rule{rule}, nil, nil, &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "db"}})
+
+	u, ok := handled.(*unstructured.Unstructured)
+	if !ok || u.GetName() != "db" || u.GetKind() != "StatefulSet" {
+		t.Fatalf("expected an unstructured StatefulSet, got %#v", handled)
+	}
+}
@@ -2,52 +2,191 @@ package engine
 
 import (
 	"context"
+	"fmt"
+	"runtime/debug"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
-	"k8s.io/apimachinery/pkg/fields"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
 )
 
 const ANNOTATION_PREFIX = "com.uswitch.alert"
 
+// informer is a shared informer for one Want that can be stopped on its own
+// when no rules want it any more.
+type informer struct {
+	cache.SharedInformer
+	want Want
+	stop context.CancelFunc
+}
+
 type Engine struct {
 	namespaceIndexer cache.Indexer
-	clientSet        *kubernetes.Clientset
-	informers        map[string]cache.SharedInformer
-	rules            []*Rule
-	outputs          map[string]Output
+	clientSet        kubernetes.Interface
+	dynamicClient    dynamic.Interface
+	tracker          *tracker
+	events           *events
+	drainTimeout     time.Duration
+	workers          int
+	ruleTimeout      time.Duration
+	deliveryPolicy   DeliveryPolicy
+	deadLetter       DeadLetter
+
+	deliveryMu sync.Mutex
+	deliveries map[destination]chan *Alert
+	delivering sync.WaitGroup
+
+	// mu guards everything below, which Reload can change while running
+	mu        sync.RWMutex
+	informers map[string]*informer
+	rules     []*Rule
+	ruleSets  map[string][]*Rule
+	outputs   map[string]Output
+
+	// leading is false while another replica is sending alerts
+	leading bool
+
+	// namespacesSynced is set once the namespaces are being watched, and
+	// lastBeat whenever Run's alert loop comes round
+	namespacesSynced cache.InformerSynced
+	lastBeat         time.Time
+	stopped          bool
+
+	// set by Run so that informers can be added later
+	running   bool
+	context   context.Context
+	namespace string
+	ageLimit  int
+	alerts    chan *Alert
+	queue     workqueue.RateLimitingInterface
 }
 
-func NewEngine(clientSet *kubernetes.Clientset) *Engine {
+const (
+	// beatInterval is how often Run's alert loop checks in when it's idle,
+	// and stallTimeout how long it can go without before it's unhealthy
+	beatInterval = 5 * time.Second
+	stallTimeout = time.Minute
+)
+
+// DefaultDrainTimeout is how long Run keeps sending alerts for once it's
+// told to stop.
+const DefaultDrainTimeout = 10 * time.Second
+
+// alertBuffer is how many alerts can wait to be sent before rules have to
+// wait for the outputs.
+const alertBuffer = 100
+
+func NewEngine(clientSet kubernetes.Interface, dynamicClient dynamic.Interface) *Engine {
 	return &Engine{
-		clientSet: clientSet,
-		informers: map[string]cache.SharedInformer{},
-		rules:     []*Rule{},
-		outputs:   map[string]Output{},
+		clientSet:      clientSet,
+		dynamicClient:  dynamicClient,
+		informers:      map[string]*informer{},
+		rules:          []*Rule{},
+		ruleSets:       map[string][]*Rule{},
+		outputs:        map[string]Output{},
+		leading:        true,
+		events:         newEvents(),
+		drainTimeout:   DefaultDrainTimeout,
+		workers:        DefaultWorkers,
+		ruleTimeout:    DefaultRuleTimeout,
+		deliveryPolicy: DefaultDeliveryPolicy,
+		deliveries:     map[destination]chan *Alert{},
+		tracker:        newTracker(NewMemoryStore(DefaultStoreSize, DefaultStoreTTL)),
 	}
 }
 
 func (e *Engine) AddRule(rule *Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
 	e.rules = append(e.rules, rule)
 }
 
 func (e *Engine) AddOutput(output Output) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
 	e.outputs[output.Key()] = output
 }
 
+// SetStore replaces where the engine remembers which alerts it has sent. It
+// should be called before Run.
+func (e *Engine) SetStore(store Store) {
+	e.tracker.setStore(store)
+}
+
+// SetDrainTimeout sets how long Run keeps sending alerts for once its context
+// is done. It should be called before Run.
+func (e *Engine) SetDrainTimeout(timeout time.Duration) {
+	e.drainTimeout = timeout
+}
+
+// SetLeading says whether this replica should send alerts, which it does
+// unless told otherwise. A replica on standby still runs the rules and keeps
+// track of what's firing, so that it can take over without repeating what
+// the leader has already sent, but drops its alerts.
+func (e *Engine) SetLeading(leading bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.leading = leading
+}
+
+// Leading says whether this replica is sending alerts.
+func (e *Engine) Leading() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.leading
+}
+
+// Rules returns the rules currently in use, including those in rule sets.
+func (e *Engine) Rules() []*Rule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.allRules()
+}
+
+// allRules returns the engine's own rules followed by each rule set's, in
+// order of set name. e.mu must be held.
+func (e *Engine) allRules() []*Rule {
+	rules := append([]*Rule{}, e.rules...)
+	for _, set := range sortedSetNames(e.ruleSets) {
+		rules = append(rules, e.ruleSets[set]...)
+	}
+	return rules
+}
+
 func (e *Engine) watchNamespaces(context context.Context) {
-	listWatcher := cache.NewListWatchFromClient(e.clientSet.CoreV1().RESTClient(), "namespaces", "", fields.Everything())
+	listWatcher := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return e.clientSet.CoreV1().Namespaces().List(context, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return e.clientSet.CoreV1().Namespaces().Watch(context, options)
+		},
+	}
 	indexer, informer := cache.NewIndexerInformer(listWatcher, &v1.Namespace{}, 0, cache.ResourceEventHandlerFuncs{}, cache.Indexers{})
 
 	go informer.Run(context.Done())
 
+	e.mu.Lock()
+	e.namespacesSynced = informer.HasSynced
+	e.mu.Unlock()
+
 	if !cache.WaitForCacheSync(context.Done(), informer.HasSynced) {
 		log.Errorf("Timed out waiting for caches to sync")
 		return
@@ -56,6 +195,59 @@ func (e *Engine) watchNamespaces(context context.Context) {
 	e.namespaceIndexer = indexer
 }
 
+// Ready returns an error unless the engine is running and it has synced the
+// namespaces and every informer's cache.
+func (e *Engine) Ready() error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if !e.running || e.namespacesSynced == nil {
+		return fmt.Errorf("not running")
+	}
+
+	if !e.namespacesSynced() {
+		return fmt.Errorf("namespaces haven't synced")
+	}
+
+	unsynced := []string{}
+	for name, inf := range e.informers {
+		if !inf.HasSynced() {
+			unsynced = append(unsynced, name)
+		}
+	}
+	if len(unsynced) > 0 {
+		sort.Strings(unsynced)
+		return fmt.Errorf("informers haven't synced: %s", strings.Join(unsynced, ", "))
+	}
+
+	return nil
+}
+
+func (e *Engine) beat() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.lastBeat = time.Now()
+}
+
+// Healthy returns an error if Run's alert loop has stalled or stopped.
+func (e *Engine) Healthy() error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.stopped {
+		return fmt.Errorf("stopped")
+	}
+
+	if e.running {
+		if since := time.Since(e.lastBeat); since > stallTimeout {
+			return fmt.Errorf("alert loop hasn't run for %s", since.Round(time.Second))
+		}
+	}
+
+	return nil
+}
+
 func resourceAge(resource interface{}) (time.Duration, error) {
 	metaObj, err := meta.Accessor(resource)
 
@@ -66,9 +258,138 @@ func resourceAge(resource interface{}) (time.Duration, error) {
 	return time.Now().Sub(metaObj.GetCreationTimestamp().Time), nil
 }
 
-func bind(rule *Rule, informer cache.SharedInformer, ageLimit int, ctx *RuleHandlerContext) {
+// rulesFor returns the current rules that want objects from want.
+func (e *Engine) rulesFor(want Want) []*Rule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	rules := []*Rule{}
+	for _, rule := range e.allRules() {
+		for _, w := range rule.Wants {
+			if w.Name == want.Name {
+				rules = append(rules, rule)
+				break
+			}
+		}
+	}
+
+	return rules
+}
+
+// runHandler runs one of rule's handlers, recording how long it took. A
+// handler that panics is logged, and false returned as it didn't finish.
+func runHandler(rule *Rule, handler func()) (finished bool) {
+	ruleEvaluations.WithLabelValues(rule.Name).Inc()
+	start := time.Now()
+
+	defer func() {
+		ruleDuration.WithLabelValues(rule.Name).Observe(time.Since(start).Seconds())
+
+		if r := recover(); r != nil {
+			rulePanics.WithLabelValues(rule.Name).Inc()
+			log.WithField("rule", rule.Name).Errorf("rule panicked: %v\n%s", r, debug.Stack())
+			finished = false
+		}
+	}()
+
+	handler()
+	return true
+}
+
+func countEmitted(alerts []*Alert) {
+	for _, alert := range alerts {
+		alertsEmitted.WithLabelValues(alert.Rule.Name, string(alert.Status)).Inc()
+	}
+}
+
+// handlerContext returns a context for rule whose calls time out after the
+// rule timeout, and which reports to emit.
+func (e *Engine) handlerContext(rule *Rule, emit func(*Alert)) (*RuleHandlerContext, context.CancelFunc) {
+	// not the engine's context, so that rules still finish while draining
+	callContext, cancel := context.WithTimeout(context.Background(), e.ruleTimeout)
+
+	return &RuleHandlerContext{
+		emit:      emit,
+		clientset: e.clientSet,
+		rule:      rule,
+		context:   callContext,
+	}, cancel
+}
+
+// handle runs each rule against the object and sends whatever the tracker
+// says has changed since it last did. It returns false if any rule didn't
+// finish.
+func (e *Engine) handle(want Want, old runtime.Object, new runtime.Object) bool {
+	finished := true
+
+	for _, rule := range e.rulesFor(want) {
+		reported := []*Alert{}
+		ctx, cancel := e.handlerContext(rule, func(alert *Alert) { reported = append(reported, alert) })
+
+		// a rule that didn't finish may not have reported everything, so
+		// what it did report can't be used to resolve anything
+		ok := runHandler(rule, func() { rule.Handler(old, new, ctx) })
+		cancel()
+		if !ok {
+			finished = false
+			continue
+		}
+		countEmitted(reported)
+
+		for _, alert := range e.tracker.update(rule, new, reported) {
+			e.alerts <- alert
+		}
+	}
+
+	return finished
+}
+
+// handleDelete runs the delete handlers of the rules that want obj, then
+// resolves everything still firing for it. It returns false if any delete
+// handler didn't finish, though the object is forgotten regardless.
+func (e *Engine) handleDelete(want Want, obj runtime.Object) bool {
+	finished := true
+	reported := []*Alert{}
+
+	for _, rule := range e.rulesFor(want) {
+		if rule.DeleteHandler == nil {
+			continue
+		}
+
+		ctx, cancel := e.handlerContext(rule, func(alert *Alert) { reported = append(reported, alert) })
+		finished = runHandler(rule, func() { rule.DeleteHandler(obj, ctx) }) && finished
+		cancel()
+	}
+	countEmitted(reported)
+
+	for _, alert := range e.tracker.delete(obj, reported, e.Rules()) {
+		e.alerts <- alert
+	}
+
+	return finished
+}
+
+// bind queues the informer's events for the workers, which run whichever
+// rules want them at the time, so rules can be swapped without touching the
+// informer.
+func (e *Engine) bind(want Want, informer cache.SharedInformer) {
+	ageLimit := e.ageLimit
+
+	enqueue := func(obj interface{}, record func(item)) {
+		it, err := itemFor(want, obj)
+		if err != nil {
+			log.Warn(err)
+			return
+		}
+
+		record(it)
+		e.queue.Add(it)
+	}
+
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
+			eventsReceived.WithLabelValues(want.Name, "add").Inc()
+
 			// we should make sure the resource is actually new, not just newly seen
 			age, err := resourceAge(obj)
 
@@ -77,41 +398,93 @@ func bind(rule *Rule, informer cache.SharedInformer, ageLimit int, ctx *RuleHand
 
 				log.Debugf("%s.%s was too old when added", metaObj.GetNamespace(), metaObj.GetName())
 			} else {
-				rule.Handler(nil, obj.(runtime.Object), ctx)
+				enqueue(obj, func(it item) { e.events.changed(it, nil) })
 			}
 		},
 		UpdateFunc: func(old interface{}, new interface{}) {
-			rule.Handler(old.(runtime.Object), new.(runtime.Object), ctx)
+			eventsReceived.WithLabelValues(want.Name, "update").Inc()
+			enqueue(new, func(it item) { e.events.changed(it, old.(runtime.Object)) })
+		},
+		DeleteFunc: func(obj interface{}) {
+			eventsReceived.WithLabelValues(want.Name, "delete").Inc()
+
+			// the watch missed the deletion, and this is the last state we saw
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+
+			if deleted, ok := obj.(runtime.Object); ok {
+				enqueue(deleted, func(it item) { e.events.deleted(it, deleted) })
+			} else {
+				log.Warnf("Couldn't handle the deletion of %v", obj)
+			}
 		},
 	})
 }
 
-func (e *Engine) attachRules(context context.Context, namespace string, ageLimit int) <-chan *Alert {
-	for _, want := range UniqueWants(e.rules) {
-		log.Debugf("Adding a shared informer for %s", want.Name)
-		listWatcher := cache.NewListWatchFromClient(want.RESTClient(e.clientSet), want.Name, namespace, fields.Everything())
-		informer := cache.NewSharedInformer(listWatcher, want.Object, 0)
+// syncInformers starts an informer for every Want that doesn't have one and
+// stops those no rule wants any more. e.mu must be held.
+func (e *Engine) syncInformers() {
+	wanted := map[string]bool{}
 
-		go informer.Run(context.Done())
+	for _, want := range UniqueWants(e.allRules()) {
+		wanted[want.Name] = true
 
-		e.informers[want.Name] = informer
-	}
+		if _, ok := e.informers[want.Name]; ok {
+			continue
+		}
 
-	alerts := make(chan *Alert)
-	for _, rule := range e.rules {
-		ctx := &RuleHandlerContext{
-			alerts:    alerts,
-			clientset: e.clientSet,
-			rule:      rule,
+		log.Debugf("Adding a shared informer for %s", want.Name)
+		informerContext, stop := context.WithCancel(e.context)
+		inf := &informer{
+			SharedInformer: cache.NewSharedInformer(e.listWatch(want, e.namespace), want.Object, 0),
+			want:           want,
+			stop:           stop,
 		}
+		e.bind(want, inf)
 
-		for _, want := range rule.Wants {
-			bind(rule, e.informers[want.Name], ageLimit, ctx)
+		go inf.Run(informerContext.Done())
+		go reportSynced(informerContext, want.Name, inf)
+
+		e.informers[want.Name] = inf
+	}
+
+	for name, inf := range e.informers {
+		if !wanted[name] {
+			log.Debugf("Removing the shared informer for %s", name)
+			inf.stop()
+			delete(e.informers, name)
+			informerSynced.DeleteLabelValues(name)
 		}
 	}
+}
 
-	return alerts
+// reportSynced marks the informer for want as synced once it is.
+func reportSynced(ctx context.Context, want string, inf cache.SharedInformer) {
+	informerSynced.WithLabelValues(want).Set(0)
 
+	if cache.WaitForCacheSync(ctx.Done(), inf.HasSynced) {
+		informerSynced.WithLabelValues(want).Set(1)
+	}
+}
+
+func (e *Engine) attachRules(context context.Context, namespace string, ageLimit int) <-chan *Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.running = true
+	e.lastBeat = time.Now()
+	e.context = context
+	e.namespace = namespace
+	e.ageLimit = ageLimit
+	e.alerts = make(chan *Alert, alertBuffer)
+	e.queue = workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "klint")
+
+	// forget anything remembered for rules that have since been removed
+	e.tracker.setRules("", e.allRules())
+	e.syncInformers()
+
+	return e.alerts
 }
 
 func extractOutputAnnotations(annotations map[string]string, out map[string]string) {
@@ -124,45 +497,134 @@ func extractOutputAnnotations(annotations map[string]string, out map[string]stri
 	}
 }
 
-func (e *Engine) Run(context context.Context, namespace string, ageLimit int) {
+// Notify sends alert to every output named in the annotations of the
+// alert's resource or its namespace.
+func (e *Engine) Notify(alert *Alert) {
 	accessor := meta.NewAccessor()
+	outputAnnotations := map[string]string{}
 
+	if e.namespaceIndexer != nil {
+		ns, _ := accessor.Namespace(alert.Resource)
+		if nsResource, exists, _ := e.namespaceIndexer.GetByKey(ns); exists {
+			nsAnnotations, _ := accessor.Annotations(nsResource.(runtime.Object))
+			extractOutputAnnotations(nsAnnotations, outputAnnotations) // kind of nasty state mutation of outputAnnotations
+		}
+	}
+
+	annotations, _ := accessor.Annotations(alert.Resource)
+	extractOutputAnnotations(annotations, outputAnnotations) // kind of nasty state mutation of outputAnnotations
+
+	if len(outputAnnotations) == 0 {
+		resourceName, _ := accessor.Name(alert.Resource)
+		log.Debugf("There where no output annotations found on resource %s", resourceName)
+	}
+
+	resourceVersion, _ := accessor.ResourceVersion(alert.Resource)
+	log.Debugf("ResourceVersion: %s", resourceVersion)
+
+	e.mu.RLock()
+	outputs := e.outputs
+	e.mu.RUnlock()
+
+	for outputKey, outputVal := range outputAnnotations {
+		if _, ok := outputs[outputKey]; ok {
+			e.deliver(outputKey, outputVal, alert)
+		} else {
+			log.Warnf("There is no output '%s'", outputKey)
+		}
+	}
+}
+
+// Audit lists every object the rules want and runs the rules against each
+// of them, regardless of age. Nothing is sent to the outputs.
+func (e *Engine) Audit(context context.Context, namespace string) ([]*Alert, error) {
 	e.watchNamespaces(context)
-	alerts := e.attachRules(context, namespace, ageLimit)
-	filteredAlerts := filterAlerts(context, alerts)
 
-	for {
-		select {
-		case alert := <-filteredAlerts:
-			log.Debugf("ALERT: %s", alert.Message)
+	rules := e.Rules()
+	alerts := []*Alert{}
 
-			outputAnnotations := map[string]string{}
+	for _, want := range UniqueWants(rules) {
+		log.Debugf("Listing %s", want.Name)
 
-			if e.namespaceIndexer != nil {
-				ns, _ := accessor.Namespace(alert.Resource)
-				nsResource, _, _ := e.namespaceIndexer.GetByKey(ns)
-				nsAnnotations, _ := accessor.Annotations(nsResource.(runtime.Object))
-				extractOutputAnnotations(nsAnnotations, outputAnnotations) // kind of nasty state mutation of outputAnnotations
-			}
+		list, err := e.listWatch(want, namespace).List(metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s: %s", want.Name, err)
+		}
 
-			annotations, _ := accessor.Annotations(alert.Resource)
-			extractOutputAnnotations(annotations, outputAnnotations) // kind of nasty state mutation of outputAnnotations
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s: %s", want.Name, err)
+		}
 
-			if len(outputAnnotations) == 0 {
-				resourceName, _ := accessor.Name(alert.Resource)
-				log.Debugf("There where no output annotations found on resource %s", resourceName)
-			}
+		for _, item := range items {
+			alerts = append(alerts, Evaluate(rules, e.clientSet, nil, item)...)
+		}
+	}
 
-			resourceVersion, _ := accessor.ResourceVersion(alert.Resource)
-			log.Debugf("ResourceVersion: %s", resourceVersion)
+	return alerts, nil
+}
 
-			for outputKey, outputVal := range outputAnnotations {
-				if output, ok := e.outputs[outputKey]; ok {
-					output.Send(outputVal, alert.Message)
-				} else {
-					log.Warnf("There is no output '%s'", outputKey)
-				}
+func (e *Engine) send(alert *Alert) {
+	if !e.Leading() {
+		log.Debugf("Not the leader, dropping ALERT: %s", alert.Message)
+		return
+	}
+	log.Debugf("ALERT: %s", alert.Message)
+	e.Notify(alert)
+}
+
+// drain sends the alerts from rules that were still running, or waiting to
+// run, when the engine was stopped, giving up after the drain timeout.
+func (e *Engine) drain(alerts <-chan *Alert, workersDone <-chan struct{}) {
+	deadline := time.Now().Add(e.drainTimeout)
+	timeout := time.After(e.drainTimeout)
+
+	for {
+		select {
+		case alert := <-alerts:
+			e.send(alert)
+		case <-workersDone:
+			for len(alerts) > 0 {
+				e.send(<-alerts)
 			}
+			if !e.WaitForDeliveries(time.Until(deadline)) {
+				log.Warnf("Gave up sending alerts after %s", e.drainTimeout)
+			}
+			return
+		case <-timeout:
+			log.Warnf("Gave up sending alerts after %s", e.drainTimeout)
+			return
+		}
+	}
+}
+
+// Run watches the cluster and sends alerts until context is done, then
+// drains whatever alerts are still on their way before returning.
+func (e *Engine) Run(context context.Context, namespace string, ageLimit int) {
+	e.watchNamespaces(context)
+	alerts := e.attachRules(context, namespace, ageLimit)
+	workersDone := e.startWorkers(e.queue)
+	go e.remind(context)
+
+	heartbeat := time.NewTicker(beatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		e.beat()
+
+		select {
+		case <-context.Done():
+			log.Infof("Stopping, sending any alerts still on their way")
+			e.queue.ShutDown()
+			e.drain(alerts, workersDone)
+
+			e.mu.Lock()
+			e.stopped = true
+			e.mu.Unlock()
+			return
+		case alert := <-alerts:
+			e.send(alert)
+		case <-heartbeat.C:
 		}
 	}
 }
@@ -0,0 +1,341 @@
+// Package enginetest runs an engine.Engine against a fake clientset so that
+// rules can be exercised end-to-end: objects are applied to the fake API and
+// the alerts that make it through to an output are recorded.
+package enginetest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	clienttesting "k8s.io/client-go/testing"
+
+	"github.com/uswitch/klint/engine"
+)
+
+const (
+	// Namespace is created by the harness and annotated so that every alert
+	// raised for an object in it is routed to the recording output.
+	Namespace = "klint-test"
+	// Target is the value of the output annotation on Namespace.
+	Target = "test-channel"
+
+	outputKey = "recorder"
+)
+
+var (
+	// WaitTimeout is how long the harness waits for something to happen.
+	WaitTimeout = 5 * time.Second
+	// QuietPeriod is how long ExpectNoAlerts waits before deciding nothing
+	// is coming.
+	QuietPeriod = 200 * time.Millisecond
+)
+
+// Sent is a single alert delivered to the RecordingOutput. Message is the
+// alert's text as a plain text output would send it.
+type Sent struct {
+	Target  string
+	Message string
+	Alert   *engine.Alert
+}
+
+// RecordingOutput is an engine.Output that keeps everything sent to it.
+type RecordingOutput struct {
+	mu   sync.Mutex
+	sent []Sent
+	ch   chan Sent
+}
+
+func NewRecordingOutput() *RecordingOutput {
+	return &RecordingOutput{ch: make(chan Sent, 100)}
+}
+
+func (r *RecordingOutput) Key() string { return outputKey }
+
+func (r *RecordingOutput) Send(target string, alert *engine.Alert) error {
+	sent := Sent{Target: target, Message: alert.Text(), Alert: alert}
+
+	r.mu.Lock()
+	r.sent = append(r.sent, sent)
+	r.mu.Unlock()
+
+	r.ch <- sent
+	return nil
+}
+
+// All returns everything sent so far.
+func (r *RecordingOutput) All() []Sent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Sent{}, r.sent...)
+}
+
+// Harness is a running engine backed by a fake clientset.
+type Harness struct {
+	t             testing.TB
+	Client        *fake.Clientset
+	DynamicClient *dynamicfake.FakeDynamicClient
+	Engine        *engine.Engine
+	Output        *RecordingOutput
+
+	watching chan string
+	stop     context.CancelFunc
+	stopped  chan struct{}
+}
+
+// watchedAs is the resource a Want's informer is seen watching by the fakes.
+func watchedAs(want engine.Want) string {
+	if want.IsDynamic() {
+		return want.Resource.Resource
+	}
+	return want.Name
+}
+
+// New starts an engine with the given rules and waits until its informers
+// are watching the fake API. The engine is stopped when the test finishes.
+// The fake dynamic client can only list resources wanted by these rules.
+func New(t testing.TB, rules ...*engine.Rule) *Harness {
+	t.Helper()
+
+	ns := &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: Namespace,
+			Annotations: map[string]string{
+				engine.ANNOTATION_PREFIX + "/" + outputKey: Target,
+			},
+		},
+	}
+
+	client := fake.NewSimpleClientset(ns)
+
+	listKinds := map[schema.GroupVersionResource]string{}
+	for _, want := range engine.UniqueWants(rules) {
+		if want.IsDynamic() {
+			listKinds[want.Resource] = want.Kind + "List"
+		}
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme.Scheme, listKinds)
+
+	// the fake tracker doesn't replay events to watches that start late, so
+	// note when each informer starts watching before applying anything
+	watching := make(chan string, 100)
+	watchReactor := func(tracker clienttesting.ObjectTracker) clienttesting.WatchReactionFunc {
+		return func(action clienttesting.Action) (bool, watch.Interface, error) {
+			w, err := tracker.Watch(action.GetResource(), action.GetNamespace())
+			if err != nil {
+				return false, nil, err
+			}
+			watching <- action.GetResource().Resource
+			return true, w, nil
+		}
+	}
+	client.PrependWatchReactor("*", watchReactor(client.Tracker()))
+	dynamicClient.PrependWatchReactor("*", watchReactor(dynamicClient.Tracker()))
+
+	h := &Harness{
+		t:             t,
+		Client:        client,
+		DynamicClient: dynamicClient,
+		Engine:        engine.NewEngine(client, dynamicClient),
+		Output:        NewRecordingOutput(),
+		watching:      watching,
+	}
+
+	for _, rule := range rules {
+		h.Engine.AddRule(rule)
+	}
+	h.Engine.AddOutput(h.Output)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	h.stop = cancel
+	h.stopped = make(chan struct{})
+	go func() {
+		defer close(h.stopped)
+		h.Engine.Run(ctx, "", 0)
+	}()
+
+	pending := map[string]bool{"namespaces": true}
+	for _, want := range engine.UniqueWants(rules) {
+		pending[watchedAs(want)] = true
+	}
+	h.waitForWatches(pending)
+
+	return h
+}
+
+// Stop stops the engine and waits for Run to return.
+func (h *Harness) Stop() {
+	h.t.Helper()
+
+	h.stop()
+	select {
+	case <-h.stopped:
+	case <-time.After(WaitTimeout):
+		h.t.Fatal("timed out waiting for the engine to stop")
+	}
+}
+
+func (h *Harness) waitForWatches(pending map[string]bool) {
+	h.t.Helper()
+
+	timeout := time.After(WaitTimeout)
+	for len(pending) > 0 {
+		select {
+		case resource := <-h.watching:
+			delete(pending, resource)
+		case <-timeout:
+			h.t.Fatalf("timed out waiting for informers to watch %v", pending)
+		}
+	}
+}
+
+// Reload swaps the engine's rules, keeping the recording output, and waits
+// for informers to start for anything that wasn't wanted before.
+func (h *Harness) Reload(rules ...*engine.Rule) {
+	h.t.Helper()
+
+	pending := map[string]bool{}
+	for _, want := range engine.UniqueWants(rules) {
+		pending[watchedAs(want)] = true
+	}
+	for _, want := range engine.UniqueWants(h.Engine.Rules()) {
+		delete(pending, watchedAs(want))
+	}
+
+	h.Engine.Reload(rules, []engine.Output{h.Output}, engine.RepeatPolicy{})
+	h.waitForWatches(pending)
+}
+
+// SetRules replaces the engine's named rule set and waits for informers to
+// start for anything that wasn't wanted before.
+func (h *Harness) SetRules(set string, rules ...*engine.Rule) {
+	h.t.Helper()
+
+	pending := map[string]bool{}
+	for _, want := range engine.UniqueWants(rules) {
+		pending[watchedAs(want)] = true
+	}
+	for _, want := range engine.UniqueWants(h.Engine.Rules()) {
+		delete(pending, watchedAs(want))
+	}
+
+	h.Engine.SetRules(set, rules)
+	h.waitForWatches(pending)
+}
+
+func (h *Harness) resourceFor(obj runtime.Object) schema.GroupVersionResource {
+	h.t.Helper()
+
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	if _, ok := obj.(*unstructured.Unstructured); !ok {
+		gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+		if err != nil {
+			h.t.Fatalf("unknown object kind: %s", err)
+		}
+		gvk = gvks[0]
+	}
+
+	gvr, _ := meta.UnsafeGuessKindToResource(gvk)
+	return gvr
+}
+
+// trackerFor returns the dynamic client's tracker for unstructured objects
+// and the clientset's for everything else.
+func (h *Harness) trackerFor(obj runtime.Object) clienttesting.ObjectTracker {
+	if _, ok := obj.(*unstructured.Unstructured); ok {
+		return h.DynamicClient.Tracker()
+	}
+	return h.Client.Tracker()
+}
+
+func (h *Harness) namespaceOf(obj runtime.Object) string {
+	h.t.Helper()
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		h.t.Fatalf("object has no metadata: %s", err)
+	}
+
+	if accessor.GetNamespace() == "" {
+		accessor.SetNamespace(Namespace)
+	}
+
+	return accessor.GetNamespace()
+}
+
+// Create adds obj to the fake API. Objects without a namespace are placed in
+// Namespace. Unstructured objects are only visible to dynamic Wants.
+func (h *Harness) Create(obj runtime.Object) {
+	h.t.Helper()
+
+	ns := h.namespaceOf(obj)
+	if err := h.trackerFor(obj).Create(h.resourceFor(obj), obj, ns); err != nil {
+		h.t.Fatalf("error creating object: %s", err)
+	}
+}
+
+// Update replaces obj in the fake API.
+func (h *Harness) Update(obj runtime.Object) {
+	h.t.Helper()
+
+	ns := h.namespaceOf(obj)
+	if err := h.trackerFor(obj).Update(h.resourceFor(obj), obj, ns); err != nil {
+		h.t.Fatalf("error updating object: %s", err)
+	}
+}
+
+// Delete removes obj from the fake API.
+func (h *Harness) Delete(obj runtime.Object) {
+	h.t.Helper()
+
+	ns := h.namespaceOf(obj)
+	accessor, _ := meta.Accessor(obj)
+	if err := h.trackerFor(obj).Delete(h.resourceFor(obj), ns, accessor.GetName()); err != nil {
+		h.t.Fatalf("error deleting object: %s", err)
+	}
+}
+
+// WaitForAlerts waits for n alerts to reach the output and returns them.
+func (h *Harness) WaitForAlerts(n int) []Sent {
+	h.t.Helper()
+
+	received := []Sent{}
+	timeout := time.After(WaitTimeout)
+
+	for len(received) < n {
+		select {
+		case sent := <-h.Output.ch:
+			received = append(received, sent)
+		case <-timeout:
+			h.t.Fatalf("timed out waiting for %d alerts, got %d: %v", n, len(received), received)
+		}
+	}
+
+	return received
+}
+
+// ExpectNoAlerts fails the test if an alert reaches the output within
+// QuietPeriod.
+func (h *Harness) ExpectNoAlerts() {
+	h.t.Helper()
+
+	select {
+	case sent := <-h.Output.ch:
+		h.t.Fatalf("unexpected alert: %v", sent)
+	case <-time.After(QuietPeriod):
+	}
+}
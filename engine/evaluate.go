@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Evaluate runs every rule that wants new against it, outside of any
+// informer, and returns the violations found: alerts rules resolve are left
+// out, as there's nothing remembered for them to resolve. old is nil when the
+// object is being seen for the first time. client may be nil if there is no
+// cluster to talk to.
+func Evaluate(rules []*Rule, client kubernetes.Interface, old runtime.Object, new runtime.Object) []*Alert {
+	alerts := []*Alert{}
+
+	for _, rule := range rules {
+		accepted, ok := rule.Accept(new)
+		if !ok {
+			continue
+		}
+
+		var acceptedOld runtime.Object
+		if old != nil {
+			acceptedOld, _ = rule.Accept(old)
+		}
+
+		ctx := &RuleHandlerContext{
+			emit: func(alert *Alert) {
+				if alert.Status == StatusFiring {
+					alerts = append(alerts, alert)
+				}
+			},
+			clientset: client,
+			rule:      rule,
+		}
+
+		rule.Handler(acceptedOld, accepted, ctx)
+	}
+
+	return alerts
+}
+
+// Violations runs rule against every object the engine's informers hold for
+// it and returns the alerts that are firing. It only sees what's been
+// watched so far, so is empty until the engine is running and its informers
+// have synced.
+func (e *Engine) Violations(rule *Rule) []*Alert {
+	objects := []runtime.Object{}
+
+	e.mu.RLock()
+	for _, want := range rule.Wants {
+		if inf, ok := e.informers[want.Name]; ok {
+			for _, obj := range inf.GetStore().List() {
+				objects = append(objects, obj.(runtime.Object))
+			}
+		}
+	}
+	e.mu.RUnlock()
+
+	firing := []*Alert{}
+	for _, obj := range objects {
+		firing = append(firing, Evaluate([]*Rule{rule}, e.clientSet, nil, obj)...)
+	}
+
+	return firing
+}
@@ -0,0 +1,33 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestHealthyWhenAlertLoopStalls(t *testing.T) {
+	e := NewEngine(fake.NewSimpleClientset(), nil)
+	if err := e.Healthy(); err != nil {
+		t.Fatalf("expected an engine that isn't running yet to be healthy, got %s", err)
+	}
+
+	e.running = true
+	e.lastBeat = time.Now()
+	if err := e.Healthy(); err != nil {
+		t.Fatalf("expected a healthy engine, got %s", err)
+	}
+
+	e.lastBeat = time.Now().Add(-2 * stallTimeout)
+	if err := e.Healthy(); err == nil {
+		t.Fatal("expected a stalled alert loop to be unhealthy")
+	}
+}
+
+func TestReadyWhenNotRunning(t *testing.T) {
+	e := NewEngine(fake.NewSimpleClientset(), nil)
+	if err := e.Ready(); err == nil {
+		t.Fatal("expected an engine that isn't running not to be ready")
+	}
+}
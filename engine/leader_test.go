@@ -0,0 +1,32 @@
+package engine_test
+
+import (
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/uswitch/klint/engine"
+	"github.com/uswitch/klint/engine/enginetest"
+)
+
+func TestStandbyDropsAlerts(t *testing.T) {
+	h := enginetest.New(t, alwaysAlert("ingresses", engine.WantIngress))
+	h.Engine.SetLeading(false)
+
+	before := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "before", UID: "before"}}
+	h.Create(before)
+	h.ExpectNoAlerts()
+
+	h.Engine.SetLeading(true)
+
+	// the leader would have sent it already
+	before.Labels = map[string]string{"changed": "true"}
+	h.Update(before)
+	h.ExpectNoAlerts()
+
+	h.Create(&networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "after", UID: "after"}})
+	if alerts := h.WaitForAlerts(1); alerts[0].Alert.Object.Name != "after" {
+		t.Fatalf("unexpected alert %v", alerts[0])
+	}
+}
@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	eventsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "klint_events_received_total",
+		Help: "Objects added, updated and deleted, by want.",
+	}, []string{"want", "event"})
+
+	informerSynced = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "klint_informer_synced",
+		Help: "Whether the informer for a want has synced its cache.",
+	}, []string{"want"})
+
+	ruleEvaluations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "klint_rule_evaluations_total",
+		Help: "Times a rule's handler has been run.",
+	}, []string{"rule"})
+
+	ruleDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "klint_rule_duration_seconds",
+		Help:    "How long a rule's handler took to run.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+	}, []string{"rule"})
+
+	rulePanics = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "klint_rule_panics_total",
+		Help: "Times a rule's handler has panicked.",
+	}, []string{"rule"})
+
+	alertsEmitted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "klint_alerts_emitted_total",
+		Help: "Alerts that rules have reported, by status.",
+	}, []string{"rule", "status"})
+
+	alertsSuppressed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "klint_alerts_suppressed_total",
+		Help: "Alerts that weren't sent because they had already been.",
+	}, []string{"rule"})
+
+	outputSends = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "klint_output_sends_total",
+		Help: "Attempts to send alerts to each output, by whether they were sent, will be retried or were given up on.",
+	}, []string{"output", "result"})
+
+	deliveryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "klint_output_delivery_seconds",
+		Help:    "How long alerts took to be sent to each output, including retries.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 8),
+	}, []string{"output"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		eventsReceived,
+		informerSynced,
+		ruleEvaluations,
+		ruleDuration,
+		rulePanics,
+		alertsEmitted,
+		alertsSuppressed,
+		outputSends,
+		deliveryDuration,
+	)
+}
@@ -0,0 +1,119 @@
+package engine_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/uswitch/klint/engine"
+	"github.com/uswitch/klint/engine/enginetest"
+)
+
+// metricValue returns the value of the counter or gauge name with labels,
+// or 0 if it hasn't been set.
+func metricValue(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+	metrics:
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if labels[label.GetName()] != label.GetValue() {
+					continue metrics
+				}
+			}
+
+			if metric.Counter != nil {
+				return metric.Counter.GetValue()
+			}
+			return metric.Gauge.GetValue()
+		}
+	}
+
+	return 0
+}
+
+func TestMetrics(t *testing.T) {
+	events := map[string]string{"want": "ingresses", "event": "add"}
+	emitted := map[string]string{"rule": "MetricsRule", "status": "firing"}
+	suppressed := map[string]string{"rule": "MetricsRule"}
+	sent := map[string]string{"output": "recorder", "result": "sent"}
+
+	before := map[string]float64{
+		"events":     metricValue(t, "klint_events_received_total", events),
+		"emitted":    metricValue(t, "klint_alerts_emitted_total", emitted),
+		"suppressed": metricValue(t, "klint_alerts_suppressed_total", suppressed),
+		"sent":       metricValue(t, "klint_output_sends_total", sent),
+	}
+
+	h := enginetest.New(t, alwaysAlert("MetricsRule", engine.WantIngress))
+
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "web", UID: "web"}}
+	h.Create(ingress)
+	h.WaitForAlerts(1)
+
+	ingress.Labels = map[string]string{"changed": "true"}
+	h.Update(ingress)
+	h.ExpectNoAlerts()
+
+	for name, expected := range map[string]struct {
+		metric string
+		labels map[string]string
+		delta  float64
+	}{
+		"events":     {"klint_events_received_total", events, 1},
+		"emitted":    {"klint_alerts_emitted_total", emitted, 2},
+		"suppressed": {"klint_alerts_suppressed_total", suppressed, 1},
+		"sent":       {"klint_output_sends_total", sent, 1},
+	} {
+		if got := metricValue(t, expected.metric, expected.labels) - before[name]; got != expected.delta {
+			t.Errorf("expected %s to go up by %v, got %v", expected.metric, expected.delta, got)
+		}
+	}
+
+	if synced := metricValue(t, "klint_informer_synced", map[string]string{"want": "ingresses"}); synced != 1 {
+		t.Errorf("expected the ingresses informer to be synced, got %v", synced)
+	}
+}
+
+func TestPanickingRulesAreRetried(t *testing.T) {
+	panicking := engine.NewRule(
+		engine.RuleMeta{Name: "PanickingRule"},
+		func(_ runtime.Object, _ runtime.Object, _ *engine.RuleHandlerContext) { panic("oops") },
+		engine.WantIngress,
+	)
+	panics := map[string]string{"rule": "PanickingRule"}
+	before := metricValue(t, "klint_rule_panics_total", panics)
+
+	h := enginetest.New(t, alwaysAlert("ingresses", engine.WantIngress), panicking)
+	h.Create(&networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "web", UID: "web"}})
+
+	// other rules still alert, and aren't repeated by the retries
+	h.WaitForAlerts(1)
+
+	deadline := time.Now().Add(enginetest.WaitTimeout)
+	for metricValue(t, "klint_rule_panics_total", panics)-before < 6 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the object to be tried 6 times")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	h.ExpectNoAlerts()
+	if got := metricValue(t, "klint_rule_panics_total", panics) - before; got != 6 {
+		t.Fatalf("expected the object to be given up on after 6 tries, got %v", got)
+	}
+}
@@ -0,0 +1,201 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	DefaultWorkers     = 4
+	DefaultRuleTimeout = 30 * time.Second
+
+	// maxRetries is how many times an object is retried when a rule
+	// panicked on it
+	maxRetries = 5
+)
+
+// item is an object waiting for the rules to be run against it. Items for
+// the same object are merged by the queue and never handled at once, so the
+// rules always see its changes in order.
+type item struct {
+	want string
+	key  string
+}
+
+// pending is what happened to an item's object since it was queued: the
+// object before the first change, and the last state seen if it was deleted.
+type pending struct {
+	old     runtime.Object
+	deleted runtime.Object
+}
+
+// events collects what's happened to each queued object.
+type events struct {
+	mu      sync.Mutex
+	pending map[item]*pending
+}
+
+func newEvents() *events {
+	return &events{pending: map[item]*pending{}}
+}
+
+// changed notes that obj was changed from old, nil when it was added, unless
+// it had already changed since it was queued.
+func (ev *events) changed(it item, old runtime.Object) {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+
+	if _, ok := ev.pending[it]; !ok {
+		ev.pending[it] = &pending{old: old}
+	}
+}
+
+func (ev *events) deleted(it item, obj runtime.Object) {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+
+	if p, ok := ev.pending[it]; ok {
+		p.deleted = obj
+	} else {
+		ev.pending[it] = &pending{old: obj, deleted: obj}
+	}
+}
+
+// take returns and forgets what's happened to it's object, or nil if it was
+// queued without changing.
+func (ev *events) take(it item) *pending {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+
+	p := ev.pending[it]
+	delete(ev.pending, it)
+	return p
+}
+
+// restore puts back what was taken for an item that's going to be retried,
+// ahead of anything that's happened to its object since.
+func (ev *events) restore(it item, p *pending) {
+	if p == nil {
+		return
+	}
+
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+
+	if since, ok := ev.pending[it]; ok && since.deleted != nil {
+		p = &pending{old: p.old, deleted: since.deleted}
+	}
+	ev.pending[it] = p
+}
+
+func itemFor(want Want, obj interface{}) (item, error) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return item{}, fmt.Errorf("couldn't queue %v: %s", obj, err)
+	}
+	return item{want: want.Name, key: key}, nil
+}
+
+// SetWorkers sets how many objects the rules are run against at once. It
+// should be called before Run.
+func (e *Engine) SetWorkers(workers int) {
+	e.workers = workers
+}
+
+// SetRuleTimeout sets how long rules have for the API calls they make with
+// RuleHandlerContext.Context. It should be called before Run.
+func (e *Engine) SetRuleTimeout(timeout time.Duration) {
+	e.ruleTimeout = timeout
+}
+
+// startWorkers starts the workers, returning a channel that's closed once
+// they've stopped, after the queue is shut down and emptied.
+func (e *Engine) startWorkers(queue workqueue.RateLimitingInterface) <-chan struct{} {
+	done := make(chan struct{})
+	workers := sync.WaitGroup{}
+
+	for i := 0; i < e.workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for e.work(queue) {
+			}
+		}()
+	}
+
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+
+	return done
+}
+
+// work handles the next item, returning false once the queue has been shut
+// down and emptied.
+func (e *Engine) work(queue workqueue.RateLimitingInterface) bool {
+	next, shutdown := queue.Get()
+	if shutdown {
+		return false
+	}
+	defer queue.Done(next)
+
+	it := next.(item)
+	p := e.events.take(it)
+	if e.process(it, p) || queue.NumRequeues(it) >= maxRetries || queue.ShuttingDown() {
+		queue.Forget(it)
+	} else {
+		e.events.restore(it, p)
+		queue.AddRateLimited(it)
+	}
+
+	return true
+}
+
+// process runs the rules against the object as the informer has it now,
+// given what's happened to it since it was queued, returning false if any
+// of them didn't finish.
+func (e *Engine) process(it item, p *pending) bool {
+	e.mu.RLock()
+	inf, ok := e.informers[it.want]
+	e.mu.RUnlock()
+
+	if !ok {
+		log.Debugf("%s is no longer wanted, dropping %s", it.want, it.key)
+		return true
+	}
+
+	current, exists, err := inf.GetStore().GetByKey(it.key)
+	if err != nil {
+		log.Errorf("error getting %s %s: %s", it.want, it.key, err)
+		return false
+	}
+
+	finished := true
+	var old runtime.Object
+	if exists {
+		old = current.(runtime.Object) // queued without changing
+	}
+	if p != nil {
+		old = p.old
+	}
+
+	// it may have been deleted and created again since it was queued
+	if p != nil && p.deleted != nil && (!exists || uidOf(p.deleted) != uidOf(current.(runtime.Object))) {
+		finished = e.handleDelete(inf.want, p.deleted)
+		old = nil
+	}
+
+	if exists {
+		finished = e.handle(inf.want, old, current.(runtime.Object)) && finished
+	}
+
+	return finished
+}
@@ -0,0 +1,110 @@
+package engine_test
+
+import (
+	"testing"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/uswitch/klint/engine"
+	"github.com/uswitch/klint/engine/enginetest"
+)
+
+func TestSlowRuleDoesntHoldUpOtherObjects(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	rule := engine.NewRule(
+		engine.RuleMeta{Name: "SometimesSlowRule"},
+		func(_ runtime.Object, new runtime.Object, ctx *engine.RuleHandlerContext) {
+			if new.(*networkingv1.Ingress).Name == "slow" {
+				<-release
+			}
+			ctx.Alert(new, "done")
+		},
+		engine.WantIngress,
+	)
+
+	h := enginetest.New(t, rule)
+
+	h.Create(&networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "slow", UID: "slow"}})
+	h.Create(&networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "fast", UID: "fast"}})
+
+	if alerts := h.WaitForAlerts(1); alerts[0].Alert.Object.Name != "fast" {
+		t.Fatalf("unexpected alert %v", alerts[0])
+	}
+}
+
+func TestRulesSeeChangesInOrder(t *testing.T) {
+	rule := engine.NewRule(
+		engine.RuleMeta{Name: "GenerationRule"},
+		func(_ runtime.Object, new runtime.Object, ctx *engine.RuleHandlerContext) {
+			ctx.Alert(new, new.(*networkingv1.Ingress).Labels["generation"])
+		},
+		engine.WantIngress,
+	)
+
+	h := enginetest.New(t, rule)
+
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "web", UID: "web"}}
+	h.Create(ingress)
+	for _, generation := range []string{"1", "2", "3", "4", "5"} {
+		ingress = ingress.DeepCopy()
+		ingress.Labels = map[string]string{"generation": generation}
+		h.Update(ingress)
+	}
+
+	// changes may be merged, but the last one is always seen last
+	for {
+		alerts := h.WaitForAlerts(1)
+		if alerts[0].Alert.Message == "5" {
+			break
+		}
+	}
+	h.ExpectNoAlerts()
+}
+
+func TestRetriesSeeWhatChanged(t *testing.T) {
+	handled, deleted := 0, 0
+	deletes := make(chan string, 2)
+
+	rule := engine.NewRule(
+		engine.RuleMeta{Name: "PanicsOnceRule"},
+		func(old runtime.Object, new runtime.Object, ctx *engine.RuleHandlerContext) {
+			if handled++; handled == 1 {
+				panic("oops")
+			}
+			if old != nil {
+				ctx.Alert(new, "treated as an update")
+			} else {
+				ctx.Alert(new, "created")
+			}
+		},
+		engine.WantIngress,
+	)
+	rule.DeleteHandler = func(obj runtime.Object, ctx *engine.RuleHandlerContext) {
+		deletes <- obj.(*networkingv1.Ingress).Name
+		if deleted++; deleted == 1 {
+			panic("oops")
+		}
+	}
+
+	h := enginetest.New(t, rule)
+
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "web", UID: "web"}}
+	h.Create(ingress)
+	if alerts := h.WaitForAlerts(1); alerts[0].Alert.Message != "created" {
+		t.Fatalf("expected the retry to see the object being created, got %q", alerts[0].Alert.Message)
+	}
+
+	h.Delete(ingress)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-deletes:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the delete handler to be called again after it panicked")
+		}
+	}
+}
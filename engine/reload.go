@@ -0,0 +1,132 @@
+package engine
+
+import (
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func diffNames(before, after map[string]bool) (added []string, removed []string) {
+	for name := range after {
+		if !before[name] {
+			added = append(added, name)
+		}
+	}
+	for name := range before {
+		if !after[name] {
+			removed = append(removed, name)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+func ruleNames(rules []*Rule) map[string]bool {
+	names := map[string]bool{}
+	for _, rule := range rules {
+		names[rule.Name] = true
+	}
+	return names
+}
+
+func outputKeys(outputs map[string]Output) map[string]bool {
+	keys := map[string]bool{}
+	for key := range outputs {
+		keys[key] = true
+	}
+	return keys
+}
+
+func wantNames(rules []*Rule) map[string]bool {
+	names := map[string]bool{}
+	for _, want := range UniqueWants(rules) {
+		names[want.Name] = true
+	}
+	return names
+}
+
+// Reload swaps the engine's rules, outputs and repeat policy for new ones in
+// one go. If the engine is running, informers are only started or stopped
+// when the set of Wants changes; events for resources that are still wanted
+// keep flowing. Violations of rules that have been removed are forgotten
+// without being resolved.
+func (e *Engine) Reload(rules []*Rule, outputs []Output, repeat RepeatPolicy) {
+	byKey := map[string]Output{}
+	for _, output := range outputs {
+		byKey[output.Key()] = output
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	addedRules, removedRules := diffNames(ruleNames(e.rules), ruleNames(rules))
+	addedOutputs, removedOutputs := diffNames(outputKeys(e.outputs), outputKeys(byKey))
+	wantsBefore := wantNames(e.allRules())
+	e.rules = rules
+	addedWants, removedWants := diffNames(wantsBefore, wantNames(e.allRules()))
+	forgotten := e.tracker.reload(e.allRules(), repeat)
+
+	log.WithFields(log.Fields{
+		"rules.added":          addedRules,
+		"rules.removed":        removedRules,
+		"outputs.added":        addedOutputs,
+		"outputs.removed":      removedOutputs,
+		"wants.added":          addedWants,
+		"wants.removed":        removedWants,
+		"violations.forgotten": forgotten,
+	}).Infof("reloading with %d rules and %d outputs", len(rules), len(byKey))
+
+	e.outputs = byKey
+
+	if e.running {
+		e.syncInformers()
+	}
+}
+
+func sortedSetNames(sets map[string][]*Rule) []string {
+	names := make([]string, 0, len(sets))
+	for name := range sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetRules replaces the rules in the named set, alongside the engine's own
+// rules, so that rules managed somewhere other than the config can change
+// without disturbing it. An empty set is removed, and the violations of rules
+// no longer in it are forgotten. Rules' ids should start with the set's name
+// and a slash: their violations are then kept until the set is first given,
+// so that what's remembered across restarts isn't forgotten while whatever
+// manages the set is still starting up.
+func (e *Engine) SetRules(set string, rules []*Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	wantsBefore := wantNames(e.allRules())
+	addedRules, removedRules := diffNames(ruleNames(e.ruleSets[set]), ruleNames(rules))
+
+	if len(rules) == 0 {
+		delete(e.ruleSets, set)
+	} else {
+		e.ruleSets[set] = rules
+	}
+
+	addedWants, removedWants := diffNames(wantsBefore, wantNames(e.allRules()))
+	forgotten := e.tracker.setRules(set, e.allRules())
+
+	log.WithFields(log.Fields{
+		"set":                  set,
+		"rules.added":          addedRules,
+		"rules.removed":        removedRules,
+		"wants.added":          addedWants,
+		"wants.removed":        removedWants,
+		"violations.forgotten": forgotten,
+	}).Infof("setting %d rules", len(rules))
+
+	if e.running {
+		e.syncInformers()
+	}
+}
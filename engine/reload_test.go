@@ -0,0 +1,90 @@
+package engine_test
+
+import (
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/uswitch/klint/engine"
+	"github.com/uswitch/klint/engine/enginetest"
+)
+
+func alwaysAlert(name string, want engine.Want) *engine.Rule {
+	return engine.NewRule(
+		engine.RuleMeta{Name: name},
+		func(_ runtime.Object, new runtime.Object, ctx *engine.RuleHandlerContext) {
+			ctx.Alert(new, name)
+		},
+		want,
+	)
+}
+
+func TestReload(t *testing.T) {
+	h := enginetest.New(t, alwaysAlert("ingresses", engine.WantIngress))
+
+	h.Create(&networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "before", UID: "before"}})
+	if alerts := h.WaitForAlerts(1); alerts[0].Alert.Message != "ingresses" {
+		t.Fatalf("unexpected alert %v", alerts[0])
+	}
+
+	h.Reload(alwaysAlert("cronjobs", engine.WantCronJobs))
+
+	h.Create(&networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "after", UID: "after"}})
+	h.ExpectNoAlerts()
+
+	h.Create(&batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "job", UID: "job"}})
+	if alerts := h.WaitForAlerts(1); alerts[0].Alert.Message != "cronjobs" {
+		t.Fatalf("unexpected alert %v", alerts[0])
+	}
+}
+
+func TestSetRulesSurvivesReload(t *testing.T) {
+	h := enginetest.New(t, alwaysAlert("ingresses", engine.WantIngress))
+
+	h.SetRules("extra", alwaysAlert("cronjobs", engine.WantCronJobs))
+	h.Reload()
+
+	if rules := h.Engine.Rules(); len(rules) != 1 || rules[0].Name != "cronjobs" {
+		t.Fatalf("expected only the rule set's rule, got %v", rules)
+	}
+
+	h.Create(&batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "job", UID: "job"}})
+	if alerts := h.WaitForAlerts(1); alerts[0].Alert.Message != "cronjobs" {
+		t.Fatalf("unexpected alert %v", alerts[0])
+	}
+
+	h.SetRules("extra")
+
+	h.Create(&batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "other", UID: "other"}})
+	h.ExpectNoAlerts()
+}
+
+func TestRuleSetsViolationsSurviveRestarts(t *testing.T) {
+	store := engine.NewMemoryStore(10, time.Hour)
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "web", UID: "web"}}
+
+	setRule := func() *engine.Rule {
+		rule := alwaysAlert("x", engine.WantIngress)
+		rule.Id = "klintrule/x"
+		return rule
+	}
+
+	h := enginetest.New(t)
+	h.Engine.SetStore(store)
+	h.SetRules("klintrule", setRule())
+	h.Create(ingress)
+	h.WaitForAlerts(1)
+	h.Stop()
+
+	// the set is given after the engine has started with the config's rules,
+	// as it is by the controller
+	restarted := enginetest.New(t, alwaysAlert("cronjobs", engine.WantCronJobs))
+	restarted.Engine.SetStore(store)
+	restarted.SetRules("klintrule", setRule())
+	restarted.Create(ingress)
+	restarted.ExpectNoAlerts()
+}
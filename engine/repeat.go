@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// remindInterval is how often the engine looks for violations that are due
+// to be sent again.
+const remindInterval = time.Minute
+
+// RepeatPolicy says how long to wait before sending a violation that's still
+// firing again. An interval for the rule takes precedence over one for its
+// severity, and both over Default. 0 means it's only sent once.
+type RepeatPolicy struct {
+	Default    time.Duration
+	Severities map[Severity]time.Duration
+	Rules      map[string]time.Duration
+}
+
+func (p RepeatPolicy) Interval(rule string, severity Severity) time.Duration {
+	if interval, ok := p.Rules[rule]; ok {
+		return interval
+	}
+	if interval, ok := p.Severities[severity]; ok {
+		return interval
+	}
+	return p.Default
+}
+
+// SetRepeatPolicy replaces how often violations that are still firing are
+// sent again.
+func (e *Engine) SetRepeatPolicy(policy RepeatPolicy) {
+	e.tracker.setRepeat(policy)
+}
+
+// remind sends the violations that are due to be sent again every
+// remindInterval until ctx is done. They're sent as they were last reported
+// rather than by running the rules again, which would see nothing changing.
+// Objects are taken from the informers' caches, so only those still being
+// watched are reminded about.
+func (e *Engine) remind(ctx context.Context) {
+	ticker := time.NewTicker(remindInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, alert := range e.tracker.remind(e.watched(e.tracker.due()), e.Rules()) {
+				e.alerts <- alert
+			}
+		}
+	}
+}
+
+// watched returns the objects the informers still have, as they last saw
+// them. Keys are the same as cache.MetaNamespaceKeyFunc's.
+func (e *Engine) watched(refs map[types.UID]ObjectReference) map[types.UID]runtime.Object {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	objects := map[types.UID]runtime.Object{}
+	for uid, ref := range refs {
+		key := ref.Name
+		if ref.Namespace != "" {
+			key = ref.Namespace + "/" + ref.Name
+		}
+
+		for _, inf := range e.informers {
+			if obj, ok, _ := inf.GetStore().GetByKey(key); ok && uidOf(obj.(runtime.Object)) == uid {
+				objects[uid] = obj.(runtime.Object)
+				break
+			}
+		}
+	}
+	return objects
+}
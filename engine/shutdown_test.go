@@ -0,0 +1,79 @@
+package engine_test
+
+import (
+	"testing"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/uswitch/klint/engine"
+	"github.com/uswitch/klint/engine/enginetest"
+)
+
+// slowRule alerts once release is closed, saying when it has started.
+func slowRule(started chan<- struct{}, release <-chan struct{}) *engine.Rule {
+	return engine.NewRule(
+		engine.RuleMeta{Name: "SlowRule"},
+		func(_ runtime.Object, new runtime.Object, ctx *engine.RuleHandlerContext) {
+			started <- struct{}{}
+			<-release
+			ctx.Alert(new, "slow")
+		},
+		engine.WantIngress,
+	)
+}
+
+func TestStopDrainsAlerts(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	h := enginetest.New(t, slowRule(started, release))
+	waitUntilReady(t, h.Engine)
+
+	h.Create(&networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "web", UID: "web"}})
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		h.Stop()
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	if alerts := h.WaitForAlerts(1); alerts[0].Alert.Message != "slow" {
+		t.Fatalf("unexpected alert %v", alerts[0])
+	}
+	<-stopped
+
+	if err := h.Engine.Healthy(); err == nil {
+		t.Fatal("expected a stopped engine to be unhealthy")
+	}
+}
+
+func waitUntilReady(t *testing.T, e *engine.Engine) {
+	t.Helper()
+
+	deadline := time.Now().Add(enginetest.WaitTimeout)
+	for err := e.Ready(); err != nil; err = e.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatalf("engine isn't ready: %s", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStopGivesUpDraining(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	defer close(release)
+
+	h := enginetest.New(t, slowRule(started, release))
+	h.Engine.SetDrainTimeout(100 * time.Millisecond)
+
+	h.Create(&networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "web", UID: "web"}})
+	<-started
+
+	h.Stop()
+	h.ExpectNoAlerts()
+}
@@ -0,0 +1,168 @@
+package engine
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Record is what's remembered about a violation that has been sent and is
+// still firing.
+type Record struct {
+	Rule     string          `json:"rule"`
+	Key      string          `json:"key,omitempty"`
+	Object   ObjectReference `json:"object"`
+	Severity Severity        `json:"severity"`
+	Message  string          `json:"message"`
+	// Sent is when the alert was last sent.
+	Sent time.Time `json:"sent"`
+}
+
+// recordKey identifies a record among an object's records.
+func recordKey(rule string, key string) string {
+	return rule + ":" + key
+}
+
+// Store keeps the records firing for each object, keyed by recordKey, so
+// that alerts aren't sent again. Implementations must be safe to use from
+// several goroutines and may forget objects, in which case their violations
+// are sent again next time they're seen.
+type Store interface {
+	Get(uid types.UID) (map[string]Record, bool)
+	Set(uid types.UID, records map[string]Record)
+	Delete(uid types.UID)
+	// Range calls fn for every object stored. fn mustn't use the store.
+	Range(fn func(uid types.UID, records map[string]Record))
+}
+
+const (
+	DefaultStoreSize = 10000
+	DefaultStoreTTL  = 7 * 24 * time.Hour
+)
+
+type storeEntry struct {
+	UID     types.UID         `json:"uid"`
+	Records map[string]Record `json:"records"`
+	Expires time.Time         `json:"expires"`
+}
+
+// MemoryStore is a Store that keeps up to size objects, forgetting the least
+// recently used beyond that and any that haven't been set for ttl.
+type MemoryStore struct {
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List // of *storeEntry, most recently used first
+	entries map[types.UID]*list.Element
+}
+
+func NewMemoryStore(size int, ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		order:   list.New(),
+		entries: map[types.UID]*list.Element{},
+	}
+}
+
+func (s *MemoryStore) Get(uid types.UID) (map[string]Record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.entries[uid]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*storeEntry)
+	if s.now().After(entry.Expires) {
+		s.remove(element)
+		return nil, false
+	}
+
+	s.order.MoveToFront(element)
+	return entry.Records, true
+}
+
+func (s *MemoryStore) Set(uid types.UID, records map[string]Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.set(&storeEntry{UID: uid, Records: records, Expires: s.now().Add(s.ttl)})
+}
+
+// set adds or replaces entry as the most recently used. s.mu must be held.
+func (s *MemoryStore) set(entry *storeEntry) {
+	if element, ok := s.entries[entry.UID]; ok {
+		element.Value = entry
+		s.order.MoveToFront(element)
+	} else {
+		s.entries[entry.UID] = s.order.PushFront(entry)
+	}
+
+	for s.size > 0 && s.order.Len() > s.size {
+		s.remove(s.order.Back())
+	}
+}
+
+func (s *MemoryStore) Delete(uid types.UID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[uid]; ok {
+		s.remove(element)
+	}
+}
+
+func (s *MemoryStore) remove(element *list.Element) {
+	s.order.Remove(element)
+	delete(s.entries, element.Value.(*storeEntry).UID)
+}
+
+func (s *MemoryStore) Range(fn func(uid types.UID, records map[string]Record)) {
+	for _, entry := range s.snapshot() {
+		fn(entry.UID, entry.Records)
+	}
+}
+
+// Len returns how many objects are stored, including any that have expired
+// but haven't been looked at since.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.order.Len()
+}
+
+// snapshot returns the unexpired entries, most recently used first.
+func (s *MemoryStore) snapshot() []storeEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	entries := []storeEntry{}
+	for element := s.order.Front(); element != nil; element = element.Next() {
+		if entry := element.Value.(*storeEntry); !now.After(entry.Expires) {
+			entries = append(entries, *entry)
+		}
+	}
+	return entries
+}
+
+// restore adds entries, most recently used first, keeping their expiry.
+func (s *MemoryStore) restore(entries []storeEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entry := entries[i]; !now.After(entry.Expires) {
+			s.set(&entry)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMemoryStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	s := NewMemoryStore(2, time.Hour)
+
+	s.Set("a", map[string]Record{"r:": {Message: "a"}})
+	s.Set("b", map[string]Record{"r:": {Message: "b"}})
+	s.Get("a")
+	s.Set("c", map[string]Record{"r:": {Message: "c"}})
+
+	if _, ok := s.Get("b"); ok {
+		t.Fatal("expected b to have been evicted")
+	}
+	for _, uid := range []string{"a", "c"} {
+		if _, ok := s.Get(types.UID(uid)); !ok {
+			t.Fatalf("expected %s to be kept", uid)
+		}
+	}
+}
+
+func TestMemoryStoreExpires(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryStore(10, time.Hour)
+	s.now = func() time.Time { return now }
+
+	s.Set("a", map[string]Record{"r:": {Message: "a"}})
+
+	now = now.Add(59 * time.Minute)
+	if _, ok := s.Get("a"); !ok {
+		t.Fatal("expected a to be kept within its ttl")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := s.Get("a"); ok {
+		t.Fatal("expected a to have expired")
+	}
+	if s.Len() != 0 {
+		t.Fatalf("expected the expired entry to be removed, got %d", s.Len())
+	}
+}
+
+func TestConfigMapStoreSurvivesRestarts(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+
+	s := NewConfigMapStore(client, "kube-system", "klint-state", 10, time.Hour)
+	s.Set("a", map[string]Record{"r:": {Rule: "r", Message: "a", Object: ObjectReference{Kind: "Pod", Name: "a", UID: "a"}}})
+
+	if err := s.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	cm, err := client.CoreV1().ConfigMaps("kube-system").Get(ctx, "klint-state", metav1.GetOptions{})
+	if err != nil || cm.Data[configMapStoreKey] == "" {
+		t.Fatalf("expected the state to be saved, got %v: %v", cm, err)
+	}
+
+	restarted := NewConfigMapStore(client, "kube-system", "klint-state", 10, time.Hour)
+	if err := restarted.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	records, ok := restarted.Get("a")
+	if !ok || records["r:"].Message != "a" || records["r:"].Object.Name != "a" {
+		t.Fatalf("expected a's records to be loaded, got %v", records)
+	}
+
+	// a second flush without changes doesn't write anything
+	client.ClearActions()
+	if err := restarted.Flush(ctx); err != nil || len(client.Actions()) != 0 {
+		t.Fatalf("expected nothing to be written, got %v: %v", client.Actions(), err)
+	}
+}
+
+func TestConfigMapStoreDoesntSaveWhenItStopsRunning(t *testing.T) {
+	client := fake.NewSimpleClientset()
+
+	s := NewConfigMapStore(client, "kube-system", "klint-state", 10, time.Hour)
+	s.Set("a", map[string]Record{"r:": {Rule: "r", Message: "a"}})
+
+	// it stops when leadership is lost, so another replica may be saving it
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.Run(ctx, time.Hour)
+
+	if actions := client.Actions(); len(actions) != 0 {
+		t.Fatalf("expected nothing to be written, got %v", actions)
+	}
+}
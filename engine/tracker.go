@@ -0,0 +1,369 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// tracker remembers the violations firing for each object and rule, so that
+// rules only need to report what's wrong with an object now. From that it
+// works out which violations are new or have changed, which should be sent,
+// and which have been fixed, which are resolved.
+type tracker struct {
+	mu     sync.Mutex
+	store  Store
+	repeat RepeatPolicy
+	now    func() time.Time
+	// loaded is the ids of the rules being run, nil until they're known
+	loaded map[string]bool
+	// given is the rule sets the engine has been given so far
+	given map[string]bool
+}
+
+func newTracker(store Store) *tracker {
+	return &tracker{store: store, now: time.Now, given: map[string]bool{}}
+}
+
+func (t *tracker) setStore(store Store) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.store = store
+	t.prune()
+}
+
+// setRules tells the tracker which rules are being run, forgetting the
+// violations of any others. set names the rule set that's just been given,
+// if any. It returns how many violations were forgotten.
+func (t *tracker) setRules(set string, rules []*Rule) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.load(set, rules)
+}
+
+// reload swaps the rules being run and the repeat policy in one go, so that
+// nothing's tracked with one but not the other. It returns how many
+// violations were forgotten.
+func (t *tracker) reload(rules []*Rule, policy RepeatPolicy) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.repeat = policy
+	return t.load("", rules)
+}
+
+// load notes which rules are being run and prunes the rest. t.mu must be
+// held.
+func (t *tracker) load(set string, rules []*Rule) int {
+	if set != "" {
+		t.given[set] = true
+	}
+
+	t.loaded = map[string]bool{}
+	for _, rule := range rules {
+		t.loaded[rule.Id] = true
+	}
+	return t.prune()
+}
+
+// isLoaded says whether the rule with id is being run. t.mu must be held.
+func (t *tracker) isLoaded(id string) bool {
+	return t.loaded == nil || t.loaded[id]
+}
+
+// isKept says whether the violations of the rule with id should be kept:
+// those of rules being run, and of rules in a set the engine hasn't been
+// given yet, which may well still be there once it has. t.mu must be held.
+func (t *tracker) isKept(id string) bool {
+	if t.isLoaded(id) {
+		return true
+	}
+
+	set, _, ok := strings.Cut(id, "/")
+	return ok && !t.given[set]
+}
+
+// prune forgets the violations of rules that aren't kept, returning how many
+// there were. t.mu must be held.
+func (t *tracker) prune() int {
+	pruned := map[types.UID]map[string]Record{}
+	forgotten := 0
+
+	t.store.Range(func(uid types.UID, records map[string]Record) {
+		kept := map[string]Record{}
+		for id, record := range records {
+			if t.isKept(record.Rule) {
+				kept[id] = record
+			}
+		}
+		if len(kept) < len(records) {
+			pruned[uid] = kept
+			forgotten += len(records) - len(kept)
+		}
+	})
+
+	for uid, records := range pruned {
+		if len(records) > 0 {
+			t.store.Set(uid, records)
+		} else {
+			t.store.Delete(uid)
+		}
+	}
+	return forgotten
+}
+
+func (t *tracker) setRepeat(policy RepeatPolicy) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.repeat = policy
+}
+
+// isDue says whether record should be sent again. t.mu must be held.
+func (t *tracker) isDue(record Record, now time.Time) bool {
+	interval := t.repeat.Interval(record.Rule, record.Severity)
+	return interval > 0 && now.Sub(record.Sent) >= interval
+}
+
+// due returns the objects with a violation that should be sent again.
+// Violations of rules that aren't being run are never due.
+func (t *tracker) due() map[types.UID]ObjectReference {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	due := map[types.UID]ObjectReference{}
+	t.store.Range(func(uid types.UID, records map[string]Record) {
+		for _, record := range records {
+			if t.isLoaded(record.Rule) && t.isDue(record, now) {
+				due[uid] = record.Object
+				break
+			}
+		}
+	})
+	return due
+}
+
+// remind returns the violations of objects that are due to be sent again,
+// as they were last reported, and notes that they've been sent.
+func (t *tracker) remind(objects map[types.UID]runtime.Object, rules []*Rule) []*Alert {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	byId := map[string]*Rule{}
+	for _, rule := range rules {
+		byId[rule.Id] = rule
+	}
+
+	now := t.now()
+	send := []*Alert{}
+	for uid, obj := range objects {
+		records, ok := t.store.Get(uid)
+		if !ok {
+			continue
+		}
+
+		reminded := false
+		for _, id := range sortedKeys(records) {
+			record := records[id]
+			rule, ok := byId[record.Rule]
+			if !ok || !t.isLoaded(record.Rule) || !t.isDue(record, now) {
+				continue
+			}
+
+			send = append(send, reminder(rule, record, obj))
+			record.Sent = now
+			records[id] = record
+			reminded = true
+		}
+
+		if reminded {
+			t.store.Set(uid, records)
+		}
+	}
+	return send
+}
+
+func uidOf(obj runtime.Object) types.UID {
+	uid, _ := meta.NewAccessor().UID(obj)
+	return uid
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func recordOf(alert *Alert) Record {
+	return Record{
+		Rule:     alert.Rule.Id,
+		Key:      alert.Key,
+		Object:   alert.Object,
+		Severity: alert.Severity,
+		Message:  alert.Message,
+	}
+}
+
+// resolution resolves a violation that's no longer reported.
+func resolution(rule *Rule, record Record, obj runtime.Object, message string) *Alert {
+	return &Alert{
+		Rule:        rule,
+		Resource:    obj,
+		Message:     message,
+		Object:      record.Object,
+		Severity:    record.Severity,
+		Key:         record.Key,
+		Fingerprint: fingerprint(rule, record.Object, record.Key),
+		Status:      StatusResolved,
+	}
+}
+
+// reminder sends a violation that's still firing again.
+func reminder(rule *Rule, record Record, obj runtime.Object) *Alert {
+	return &Alert{
+		Rule:        rule,
+		Resource:    obj,
+		Message:     record.Message,
+		Object:      record.Object,
+		Severity:    record.Severity,
+		Key:         record.Key,
+		Fingerprint: fingerprint(rule, record.Object, record.Key),
+		Status:      StatusFiring,
+	}
+}
+
+func fixedMessage(rule *Rule, record Record) string {
+	if record.Key == "" {
+		return fmt.Sprintf("%s no longer breaks %s", record.Object, rule.Name)
+	}
+	return fmt.Sprintf("%s no longer breaks %s (%s)", record.Object, rule.Name, record.Key)
+}
+
+// update takes everything rule reported about obj in one evaluation and
+// returns the alerts to send. Violations that are still firing with the same
+// message aren't sent again until the repeat policy says so. A rule can
+// resolve a violation itself, to say something more helpful than the
+// default. Rules that have been removed since they were run are ignored, and
+// the violations of any others that have been are dropped.
+func (t *tracker) update(rule *Rule, obj runtime.Object, alerts []*Alert) []*Alert {
+	uid := uidOf(obj)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.isLoaded(rule.Id) {
+		return nil
+	}
+
+	now := t.now()
+	before, _ := t.store.Get(uid)
+
+	// records for other rules are kept as they are
+	after := map[string]Record{}
+	for id, record := range before {
+		if record.Rule != rule.Id && t.isKept(record.Rule) {
+			after[id] = record
+		}
+	}
+
+	explicit := map[string]*Alert{}
+	send := []*Alert{}
+
+	for _, alert := range alerts {
+		id := recordKey(rule.Id, alert.Key)
+
+		if alert.Resolved() {
+			explicit[id] = alert
+			continue
+		}
+
+		record := recordOf(alert)
+		record.Sent = now
+		if last, ok := before[id]; !ok || last.Message != alert.Message || t.isDue(last, now) {
+			send = append(send, alert)
+		} else {
+			record.Sent = last.Sent
+			alertsSuppressed.WithLabelValues(rule.Name).Inc()
+		}
+		after[id] = record
+	}
+
+	for _, id := range sortedKeys(before) {
+		record := before[id]
+		if _, ok := after[id]; ok || record.Rule != rule.Id {
+			continue
+		}
+
+		if resolved, ok := explicit[id]; ok {
+			send = append(send, resolved)
+		} else {
+			send = append(send, resolution(rule, record, obj, fixedMessage(rule, record)))
+		}
+	}
+
+	if len(after) > 0 {
+		t.store.Set(uid, after)
+	} else if len(before) > 0 {
+		t.store.Delete(uid)
+	}
+
+	return send
+}
+
+// delete forgets obj and resolves everything still firing for it. alerts are
+// what rules' delete handlers reported: firing alerts are sent as they are
+// and resolved ones take the place of the default resolution. Violations of
+// rules that have since been removed are forgotten without being resolved.
+func (t *tracker) delete(obj runtime.Object, alerts []*Alert, rules []*Rule) []*Alert {
+	uid := uidOf(obj)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	records, _ := t.store.Get(uid)
+	t.store.Delete(uid)
+
+	explicit := map[string]*Alert{}
+	send := []*Alert{}
+	for _, alert := range alerts {
+		if alert.Resolved() {
+			explicit[recordKey(alert.Rule.Id, alert.Key)] = alert
+		} else {
+			send = append(send, alert)
+		}
+	}
+
+	byId := map[string]*Rule{}
+	for _, rule := range rules {
+		byId[rule.Id] = rule
+	}
+
+	for _, id := range sortedKeys(records) {
+		record := records[id]
+
+		rule, ok := byId[record.Rule]
+		if !ok {
+			continue
+		}
+
+		if resolved, ok := explicit[id]; ok {
+			send = append(send, resolved)
+		} else {
+			send = append(send, resolution(rule, record, obj, fmt.Sprintf("%s was deleted", record.Object)))
+		}
+	}
+
+	return send
+}
@@ -0,0 +1,270 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	metatypes "k8s.io/apimachinery/pkg/types"
+)
+
+var testRule = NewRule(
+	RuleMeta{Name: "TestRule"},
+	func(_ runtime.Object, _ runtime.Object, _ *RuleHandlerContext) {},
+)
+
+func createResource(id string) runtime.Object {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: id,
+			UID:  metatypes.UID(id),
+		},
+	}
+}
+
+// report is what testRule would emit for obj through ctx.
+func report(obj runtime.Object, status Status, keysAndMessages ...string) []*Alert {
+	alerts := []*Alert{}
+	ctx := &RuleHandlerContext{emit: func(alert *Alert) { alerts = append(alerts, alert) }, rule: testRule}
+
+	for i := 0; i < len(keysAndMessages); i += 2 {
+		ctx.send(obj, keysAndMessages[i], keysAndMessages[i+1], status)
+	}
+	return alerts
+}
+
+func messages(alerts []*Alert) []string {
+	out := []string{}
+	for _, alert := range alerts {
+		out = append(out, string(alert.Status)+": "+alert.Message)
+	}
+	return out
+}
+
+func expectSent(t *testing.T, sent []*Alert, expected ...string) {
+	t.Helper()
+
+	got := messages(sent)
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+	}
+}
+
+func TestThing(t *testing.T) {
+	tr := newTracker(NewMemoryStore(DefaultStoreSize, DefaultStoreTTL))
+	pod := createResource("123")
+
+	expectSent(t, tr.update(testRule, pod, report(pod, StatusFiring, "", "Foobles")), "firing: Foobles")
+	expectSent(t, tr.update(testRule, pod, report(pod, StatusFiring, "", "Foobles")))
+	expectSent(t, tr.update(testRule, pod, report(pod, StatusFiring, "", "Barbles")), "firing: Barbles")
+}
+
+func TestTrackerResolvesFixedViolations(t *testing.T) {
+	tr := newTracker(NewMemoryStore(DefaultStoreSize, DefaultStoreTTL))
+	pod := createResource("123")
+
+	expectSent(t, tr.update(testRule, pod, report(pod, StatusFiring, "cpu", "no cpu", "memory", "no memory")),
+		"firing: no cpu", "firing: no memory")
+
+	expectSent(t, tr.update(testRule, pod, report(pod, StatusFiring, "memory", "no memory")),
+		"resolved: Pod/123 no longer breaks TestRule (cpu)")
+
+	expectSent(t, tr.update(testRule, pod, nil),
+		"resolved: Pod/123 no longer breaks TestRule (memory)")
+
+	// nothing is left to resolve
+	expectSent(t, tr.update(testRule, pod, nil))
+	if n := tr.store.(*MemoryStore).Len(); n != 0 {
+		t.Fatalf("expected nothing to be tracked, got %d objects", n)
+	}
+}
+
+func TestTrackerExplicitResolve(t *testing.T) {
+	tr := newTracker(NewMemoryStore(DefaultStoreSize, DefaultStoreTTL))
+	pod := createResource("123")
+
+	// resolving something that wasn't firing says nothing
+	expectSent(t, tr.update(testRule, pod, report(pod, StatusResolved, "", "Thanks")))
+
+	tr.update(testRule, pod, report(pod, StatusFiring, "", "Foobles"))
+	expectSent(t, tr.update(testRule, pod, report(pod, StatusResolved, "", "Thanks")), "resolved: Thanks")
+}
+
+func TestTrackerDelete(t *testing.T) {
+	tr := newTracker(NewMemoryStore(DefaultStoreSize, DefaultStoreTTL))
+	pod := createResource("123")
+
+	tr.update(testRule, pod, report(pod, StatusFiring, "", "Foobles"))
+	expectSent(t, tr.delete(pod, nil, []*Rule{testRule}), "resolved: Pod/123 was deleted")
+
+	// the object's state was forgotten, so the same alert is sent again
+	expectSent(t, tr.update(testRule, pod, report(pod, StatusFiring, "", "Foobles")), "firing: Foobles")
+}
+
+func TestTrackerForgetsRemovedRules(t *testing.T) {
+	tr := newTracker(NewMemoryStore(DefaultStoreSize, DefaultStoreTTL))
+	pod := createResource("123")
+
+	tr.update(testRule, pod, report(pod, StatusFiring, "", "Foobles"))
+
+	// testRule has gone, so there's nothing to resolve its violation with
+	expectSent(t, tr.delete(pod, nil, nil))
+}
+
+func TestTrackerSetRulesForgetsRemovedRules(t *testing.T) {
+	store := NewMemoryStore(DefaultStoreSize, DefaultStoreTTL)
+	tr := newTracker(store)
+	pod, other := createResource("123"), createResource("456")
+	otherRule := NewRule(RuleMeta{Name: "OtherRule"}, testRule.Handler)
+
+	tr.update(testRule, pod, report(pod, StatusFiring, "", "Foobles"))
+	tr.update(testRule, other, report(other, StatusFiring, "", "Foobles"))
+	ctx := &RuleHandlerContext{emit: func(alert *Alert) { tr.update(otherRule, pod, []*Alert{alert}) }, rule: otherRule}
+	ctx.Alert(pod, "Barbles")
+
+	if forgotten := tr.setRules("", []*Rule{otherRule}); forgotten != 2 {
+		t.Fatalf("expected 2 violations to be forgotten, got %d", forgotten)
+	}
+	if records, _ := store.Get("123"); len(records) != 1 {
+		t.Fatalf("expected only OtherRule's violation to be kept, got %v", records)
+	}
+	if _, ok := store.Get("456"); ok {
+		t.Fatal("expected an object with nothing left firing to be forgotten")
+	}
+
+	// testRule's violation was forgotten, so it's sent again if it comes back
+	tr.setRules("", []*Rule{testRule, otherRule})
+	expectSent(t, tr.update(testRule, pod, report(pod, StatusFiring, "", "Foobles")), "firing: Foobles")
+}
+
+func TestTrackerIgnoresRemovedRules(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore(DefaultStoreSize, time.Hour)
+	store.now = func() time.Time { return now }
+
+	tr := newTracker(store)
+	tr.now = func() time.Time { return now }
+	tr.setRepeat(RepeatPolicy{Default: time.Hour})
+
+	pod := createResource("123")
+	otherRule := NewRule(RuleMeta{Name: "OtherRule"}, testRule.Handler)
+	tr.setRules("", []*Rule{otherRule})
+
+	// testRule was removed while it was being run, so what it found is dropped
+	expectSent(t, tr.update(testRule, pod, report(pod, StatusFiring, "", "Foobles")))
+
+	// and anything it left behind isn't reminded about or kept alive by other rules
+	store.Set("123", map[string]Record{recordKey(testRule.Id, ""): recordOf(report(pod, StatusFiring, "", "Foobles")[0])})
+	for i := 0; i < 10; i++ {
+		now = now.Add(time.Hour)
+		if due := tr.due(); len(due) != 0 {
+			t.Fatalf("expected nothing to be due after %dh, got %v", i+1, due)
+		}
+		tr.update(otherRule, pod, nil)
+	}
+
+	if records, ok := store.Get("123"); ok {
+		t.Fatalf("expected the removed rule's violation to be forgotten, got %v", records)
+	}
+}
+
+func TestTrackerKeepsOtherRules(t *testing.T) {
+	tr := newTracker(NewMemoryStore(DefaultStoreSize, DefaultStoreTTL))
+	pod := createResource("123")
+	otherRule := NewRule(RuleMeta{Name: "OtherRule"}, testRule.Handler)
+
+	tr.update(testRule, pod, report(pod, StatusFiring, "", "Foobles"))
+	other := &RuleHandlerContext{emit: func(alert *Alert) { tr.update(otherRule, pod, []*Alert{alert}) }, rule: otherRule}
+	other.Alert(pod, "Barbles")
+
+	// otherRule reporting nothing doesn't resolve testRule's violation
+	expectSent(t, tr.update(otherRule, pod, nil), "resolved: Pod/123 no longer breaks OtherRule")
+	expectSent(t, tr.update(testRule, pod, report(pod, StatusFiring, "", "Foobles")))
+}
+
+func TestTrackerRepeats(t *testing.T) {
+	now := time.Now()
+	tr := newTracker(NewMemoryStore(DefaultStoreSize, DefaultStoreTTL))
+	tr.now = func() time.Time { return now }
+	tr.setRepeat(RepeatPolicy{Default: time.Hour})
+	pod := createResource("123")
+
+	expectSent(t, tr.update(testRule, pod, report(pod, StatusFiring, "", "Foobles")), "firing: Foobles")
+
+	now = now.Add(59 * time.Minute)
+	expectSent(t, tr.update(testRule, pod, report(pod, StatusFiring, "", "Foobles")))
+	if due := tr.due(); len(due) != 0 {
+		t.Fatalf("expected nothing to be due, got %v", due)
+	}
+
+	now = now.Add(time.Minute)
+	if due := tr.due(); due["123"].Name != "123" {
+		t.Fatalf("expected the pod to be due, got %v", due)
+	}
+	expectSent(t, tr.update(testRule, pod, report(pod, StatusFiring, "", "Foobles")), "firing: Foobles")
+
+	// the interval starts again from when it was last sent
+	now = now.Add(30 * time.Minute)
+	expectSent(t, tr.update(testRule, pod, report(pod, StatusFiring, "", "Foobles")))
+
+	// 0 never repeats
+	tr.setRepeat(RepeatPolicy{Rules: map[string]time.Duration{"TestRule": 0}, Default: time.Hour})
+	now = now.Add(24 * time.Hour)
+	expectSent(t, tr.update(testRule, pod, report(pod, StatusFiring, "", "Foobles")))
+}
+
+func TestTrackerRemindsWithWhatWasReported(t *testing.T) {
+	now := time.Now()
+	tr := newTracker(NewMemoryStore(DefaultStoreSize, DefaultStoreTTL))
+	tr.now = func() time.Time { return now }
+	tr.setRepeat(RepeatPolicy{Default: time.Hour})
+	pod := createResource("123")
+	objects := map[metatypes.UID]runtime.Object{"123": pod}
+
+	expectSent(t, tr.update(testRule, pod, report(pod, StatusFiring, "", "Foobles")), "firing: Foobles")
+	expectSent(t, tr.remind(objects, []*Rule{testRule}))
+
+	now = now.Add(time.Hour)
+	reminders := tr.remind(objects, []*Rule{testRule})
+	expectSent(t, reminders, "firing: Foobles")
+	if reminders[0].Rule != testRule || reminders[0].Resource != pod {
+		t.Fatalf("expected the reminder to be about the pod and rule, got %+v", reminders[0])
+	}
+
+	// it's been sent, so isn't due again until the interval's passed
+	now = now.Add(30 * time.Minute)
+	expectSent(t, tr.remind(objects, []*Rule{testRule}))
+	expectSent(t, tr.update(testRule, pod, report(pod, StatusFiring, "", "Foobles")))
+	if due := tr.due(); len(due) != 0 {
+		t.Fatalf("expected nothing to be due, got %v", due)
+	}
+}
+
+func TestRepeatPolicyInterval(t *testing.T) {
+	policy := RepeatPolicy{
+		Default:    24 * time.Hour,
+		Severities: map[Severity]time.Duration{SeverityCritical: time.Hour},
+		Rules:      map[string]time.Duration{"TestRule": 0},
+	}
+
+	for _, c := range []struct {
+		rule     string
+		severity Severity
+		expected time.Duration
+	}{
+		{"TestRule", SeverityCritical, 0},
+		{"OtherRule", SeverityCritical, time.Hour},
+		{"OtherRule", SeverityWarning, 24 * time.Hour},
+	} {
+		if got := policy.Interval(c.rule, c.severity); got != c.expected {
+			t.Errorf("expected %s for %s (%s), got %s", c.expected, c.rule, c.severity, got)
+		}
+	}
+}
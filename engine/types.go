@@ -1,108 +1,219 @@
 package engine
 
 import (
+	"context"
 	"fmt"
 
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-
-	uuid "github.com/satori/go.uuid"
+	"k8s.io/client-go/tools/cache"
 )
 
-type Output interface {
-	Key() string
-	Send(string, string) error
-}
-
-type Alert struct {
-	Rule     *Rule
-	Resource runtime.Object
-	Message  string
-}
-
-func NewAlert(resource runtime.Object, message string) *Alert {
-	return &Alert{
-		Resource: resource,
-		Message:  message,
-	}
-}
-
+// Want describes a resource type that rules can subscribe to. ListWatch builds
+// the ListerWatcher used by the shared informer, using the typed clients so
+// that the engine works against any kubernetes.Interface (including fakes).
 type Want struct {
-	Name       string
-	Object     runtime.Object
-	RESTClient func(*kubernetes.Clientset) rest.Interface
+	Name      string
+	Object    runtime.Object
+	ListWatch func(kubernetes.Interface, string) cache.ListerWatcher
+
+	// Resource and Kind are set instead of ListWatch by WantResource, for
+	// resources watched through the dynamic client.
+	Resource schema.GroupVersionResource
+	Kind     string
 }
 
 var (
 	WantPods = Want{
-		"pods", &v1.Pod{},
-		func(cs *kubernetes.Clientset) rest.Interface {
-			return cs.CoreV1().RESTClient()
+		Name:   "pods",
+		Object: &v1.Pod{},
+		ListWatch: func(cs kubernetes.Interface, namespace string) cache.ListerWatcher {
+			return &cache.ListWatch{
+				ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+					return cs.CoreV1().Pods(namespace).List(context.TODO(), options)
+				},
+				WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+					return cs.CoreV1().Pods(namespace).Watch(context.TODO(), options)
+				},
+			}
 		},
 	}
 	WantDeployments = Want{
-		"deployments", &appsv1.Deployment{},
-		func(cs *kubernetes.Clientset) rest.Interface {
-			return cs.AppsV1().RESTClient()
+		Name:   "deployments",
+		Object: &appsv1.Deployment{},
+		ListWatch: func(cs kubernetes.Interface, namespace string) cache.ListerWatcher {
+			return &cache.ListWatch{
+				ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+					return cs.AppsV1().Deployments(namespace).List(context.TODO(), options)
+				},
+				WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+					return cs.AppsV1().Deployments(namespace).Watch(context.TODO(), options)
+				},
+			}
 		},
 	}
 	WantCronJobs = Want{
-		"cronjobs", &batchv1.CronJob{},
-		func(cs *kubernetes.Clientset) rest.Interface {
-			return cs.BatchV1().RESTClient()
+		Name:   "cronjobs",
+		Object: &batchv1.CronJob{},
+		ListWatch: func(cs kubernetes.Interface, namespace string) cache.ListerWatcher {
+			return &cache.ListWatch{
+				ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+					return cs.BatchV1().CronJobs(namespace).List(context.TODO(), options)
+				},
+				WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+					return cs.BatchV1().CronJobs(namespace).Watch(context.TODO(), options)
+				},
+			}
 		},
 	}
 	WantIngress = Want{
-		"ingresses", &networkingv1.Ingress{},
-		func(cs *kubernetes.Clientset) rest.Interface {
-			return cs.NetworkingV1().RESTClient()
+		Name:   "ingresses",
+		Object: &networkingv1.Ingress{},
+		ListWatch: func(cs kubernetes.Interface, namespace string) cache.ListerWatcher {
+			return &cache.ListWatch{
+				ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+					return cs.NetworkingV1().Ingresses(namespace).List(context.TODO(), options)
+				},
+				WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+					return cs.NetworkingV1().Ingresses(namespace).Watch(context.TODO(), options)
+				},
+			}
 		},
 	}
 )
 
 type RuleHandlerContext struct {
-	alerts    chan *Alert
-	clientset *kubernetes.Clientset
+	emit      func(*Alert)
+	clientset kubernetes.Interface
 	rule      *Rule
+	context   context.Context
 }
 
-func (ctx *RuleHandlerContext) Alert(obj runtime.Object, message string) {
+func (ctx *RuleHandlerContext) send(obj runtime.Object, key string, message string, status Status) {
 	alert := NewAlert(obj, message)
 	alert.Rule = ctx.rule
-	ctx.alerts <- alert
+	alert.Severity = ctx.rule.Severity
+	alert.Key = key
+	alert.Fingerprint = fingerprint(ctx.rule, alert.Object, key)
+	alert.Status = status
+	ctx.emit(alert)
+}
+
+// Alert reports that obj breaks the rule. Rules report every violation each
+// time they're run; the engine works out which are new and which have been
+// fixed since the last time.
+func (ctx *RuleHandlerContext) Alert(obj runtime.Object, message string) {
+	ctx.send(obj, "", message, StatusFiring)
 }
 
 func (ctx *RuleHandlerContext) Alertf(obj runtime.Object, format string, objs ...interface{}) {
 	ctx.Alert(obj, fmt.Sprintf(format, objs...))
 }
 
-func (ctx *RuleHandlerContext) Client() *kubernetes.Clientset {
+// AlertKey reports one of several violations of the rule by obj. key tells
+// them apart, e.g. by naming the field or container at fault, so each is
+// resolved on its own.
+func (ctx *RuleHandlerContext) AlertKey(obj runtime.Object, key string, message string) {
+	ctx.send(obj, key, message, StatusFiring)
+}
+
+func (ctx *RuleHandlerContext) AlertKeyf(obj runtime.Object, key string, format string, objs ...interface{}) {
+	ctx.AlertKey(obj, key, fmt.Sprintf(format, objs...))
+}
+
+// Resolve replaces the message the engine sends when a violation reported
+// with Alert is fixed. It's only sent if the violation was firing.
+func (ctx *RuleHandlerContext) Resolve(obj runtime.Object, message string) {
+	ctx.send(obj, "", message, StatusResolved)
+}
+
+func (ctx *RuleHandlerContext) Resolvef(obj runtime.Object, format string, objs ...interface{}) {
+	ctx.Resolve(obj, fmt.Sprintf(format, objs...))
+}
+
+// Client returns the clientset rules can use to look things up. It is nil
+// when rules are evaluated outside of a cluster, e.g. by Evaluate.
+func (ctx *RuleHandlerContext) Client() kubernetes.Interface {
 	return ctx.clientset
 }
 
+// Context is for the calls rules make with Client, and is cancelled if they
+// take too long.
+func (ctx *RuleHandlerContext) Context() context.Context {
+	if ctx.context == nil {
+		return context.Background()
+	}
+	return ctx.context
+}
+
 type RuleHandler func(runtime.Object, runtime.Object, *RuleHandlerContext)
 
+// DeleteHandler is given the last known state of an object that has been
+// deleted.
+type DeleteHandler func(runtime.Object, *RuleHandlerContext)
+
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// RuleMeta describes a rule to the people it alerts. Name should be unique
+// and stable as it identifies the rule across restarts.
+type RuleMeta struct {
+	Name        string
+	Description string
+	Severity    Severity
+	DocsURL     string
+}
+
 type Rule struct {
+	RuleMeta
 	Id      string
 	Wants   []Want
 	Handler RuleHandler
+	// DeleteHandler is optional. Without one a rule is only told about
+	// deletions by its alerts for the object being resolved.
+	DeleteHandler DeleteHandler
 }
 
-func NewRule(handler RuleHandler, wants ...Want) *Rule {
+// NewRule creates a rule from its metadata. Severity defaults to warning.
+func NewRule(meta RuleMeta, handler RuleHandler, wants ...Want) *Rule {
+	if meta.Severity == "" {
+		meta.Severity = SeverityWarning
+	}
+
 	rule := &Rule{
-		Id:      uuid.NewV4().String(),
-		Wants:   wants,
-		Handler: handler,
+		RuleMeta: meta,
+		Id:       meta.Name,
+		Wants:    wants,
+		Handler:  handler,
 	}
 
 	return rule
 }
 
+// Accept returns obj in the form the rule's handler expects, or false if
+// none of the rule's Wants are for objects like it.
+func (r *Rule) Accept(obj runtime.Object) (runtime.Object, bool) {
+	for _, want := range r.Wants {
+		if accepted, ok := want.Accept(obj); ok {
+			return accepted, true
+		}
+	}
+
+	return nil, false
+}
+
 func UniqueWants(rules []*Rule) []Want {
 	haveWantFor := map[string]bool{}
 	wants := []Want{}
@@ -0,0 +1,232 @@
+package klintrule
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/uswitch/klint/engine"
+	"github.com/uswitch/klint/rules"
+)
+
+const (
+	// ruleSet is the engine rule set KlintRules are loaded into.
+	ruleSet = "klintrule"
+
+	// idPrefix is put before a KlintRule's name to make its rule's id, so
+	// that what's remembered about it is kept apart from a config rule with
+	// the same name, and kept until the set is first given to the engine.
+	idPrefix = ruleSet + "/"
+)
+
+// loaded is a KlintRule's engine rule, or why it couldn't be made, as of a
+// generation of the object.
+type loaded struct {
+	generation int64
+	rule       *engine.Rule
+	err        error
+}
+
+// Controller keeps an engine's KlintRule rule set in step with the
+// KlintRules in the cluster and writes how many objects break each one back
+// to its status.
+type Controller struct {
+	client   dynamic.Interface
+	engine   *engine.Engine
+	interval time.Duration
+	informer cache.SharedInformer
+
+	mu     sync.Mutex
+	loaded map[string]loaded
+	// given says whether the engine has been given the rule set yet
+	given bool
+}
+
+// NewController creates a controller for e. Statuses are updated every
+// interval.
+func NewController(client dynamic.Interface, e *engine.Engine, interval time.Duration) *Controller {
+	listWatcher := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return client.Resource(Resource).List(context.TODO(), options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return client.Resource(Resource).Watch(context.TODO(), options)
+		},
+	}
+
+	return &Controller{
+		client:   client,
+		engine:   e,
+		interval: interval,
+		informer: cache.NewSharedInformer(listWatcher, &unstructured.Unstructured{}, 0),
+		loaded:   map[string]loaded{},
+	}
+}
+
+// Run watches KlintRules until ctx is done. Statuses are only written while
+// the engine is leading, so that replicas on standby don't fight over them.
+func (c *Controller) Run(ctx context.Context) {
+	c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { c.sync() },
+		UpdateFunc: func(interface{}, interface{}) { c.sync() },
+		DeleteFunc: func(interface{}) { c.sync() },
+	})
+
+	go c.informer.Run(ctx.Done())
+
+	if !cache.WaitForCacheSync(ctx.Done(), c.informer.HasSynced) {
+		log.Errorf("Timed out waiting for KlintRules to sync")
+		return
+	}
+	c.sync()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if c.engine.Leading() {
+				c.updateStatuses(ctx)
+			}
+		}
+	}
+}
+
+func (c *Controller) objects() []*unstructured.Unstructured {
+	objects := []*unstructured.Unstructured{}
+	for _, obj := range c.informer.GetStore().List() {
+		objects = append(objects, obj.(*unstructured.Unstructured))
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].GetName() < objects[j].GetName() })
+	return objects
+}
+
+func load(obj *unstructured.Unstructured) loaded {
+	klintRule, err := fromUnstructured(obj)
+	if err != nil {
+		return loaded{generation: obj.GetGeneration(), err: err}
+	}
+
+	rule, err := rules.NewCELRule(klintRule.CELRule())
+	if err != nil {
+		return loaded{generation: obj.GetGeneration(), err: err}
+	}
+
+	rule.Id = idPrefix + klintRule.Name
+	return loaded{generation: obj.GetGeneration(), rule: rule}
+}
+
+// sync rebuilds the rules for KlintRules whose spec has changed, and gives
+// the engine the new rule set if anything was added, changed or removed.
+// Nothing is given until every KlintRule has been listed, as the engine
+// forgets the violations of rules missing from the set.
+func (c *Controller) sync() {
+	if !c.informer.HasSynced() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	changed := false
+	seen := map[string]bool{}
+	set := []*engine.Rule{}
+
+	for _, obj := range c.objects() {
+		name := obj.GetName()
+		seen[name] = true
+
+		current, ok := c.loaded[name]
+		if !ok || current.generation != obj.GetGeneration() {
+			current = load(obj)
+			c.loaded[name] = current
+			changed = true
+
+			if current.err != nil {
+				log.WithField("klintrule", name).Warnf("error loading KlintRule: %s", current.err)
+			}
+		}
+
+		if current.rule != nil {
+			set = append(set, current.rule)
+		}
+	}
+
+	for name := range c.loaded {
+		if !seen[name] {
+			delete(c.loaded, name)
+			changed = true
+		}
+	}
+
+	if changed || !c.given {
+		c.engine.SetRules(ruleSet, set)
+		c.given = true
+	}
+}
+
+func (c *Controller) status(name string) (Status, bool) {
+	c.mu.Lock()
+	current, ok := c.loaded[name]
+	c.mu.Unlock()
+
+	if !ok {
+		return Status{}, false
+	}
+
+	status := Status{ObservedGeneration: current.generation}
+	if current.err != nil {
+		status.Error = current.err.Error()
+	} else {
+		status.Violations = len(c.engine.Violations(current.rule))
+	}
+
+	return status, true
+}
+
+// updateStatuses writes the status of every KlintRule whose status has
+// changed. Failures are logged and retried next time round.
+func (c *Controller) updateStatuses(ctx context.Context) {
+	for _, obj := range c.objects() {
+		logger := log.WithField("klintrule", obj.GetName())
+
+		status, ok := c.status(obj.GetName())
+		if !ok {
+			continue
+		}
+
+		if klintRule, err := fromUnstructured(obj); err == nil && klintRule.Status == status {
+			continue
+		}
+
+		fields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+		if err != nil {
+			logger.Errorf("error converting status: %s", err)
+			continue
+		}
+
+		updated := obj.DeepCopy()
+		updated.Object["status"] = fields
+
+		if _, err := c.client.Resource(Resource).UpdateStatus(ctx, updated, metav1.UpdateOptions{}); err != nil {
+			logger.Warnf("error updating status: %s", err)
+			continue
+		}
+
+		logger.Debugf("updated status: %d violations", status.Violations)
+	}
+}
@@ -0,0 +1,166 @@
+package klintrule
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/uswitch/klint/engine"
+)
+
+var deployments = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+
+func klintRule(name string, spec map[string]interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	u.SetAPIVersion(Resource.GroupVersion().String())
+	u.SetKind(Kind)
+	u.SetName(name)
+	u.SetGeneration(1)
+	return u
+}
+
+func deployment(name string, replicas int64) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"replicas": replicas},
+	}}
+	u.SetAPIVersion("apps/v1")
+	u.SetKind("Deployment")
+	u.SetNamespace("default")
+	u.SetName(name)
+	return u
+}
+
+func waitForStatus(t *testing.T, client *dynamicfake.FakeDynamicClient, name string, expected Status) {
+	t.Helper()
+
+	var status Status
+	err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		obj, err := client.Resource(Resource).Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+
+		klintRule, err := fromUnstructured(obj)
+		if err != nil {
+			return false, err
+		}
+
+		status = klintRule.Status
+		return status == expected, nil
+	})
+	if err != nil {
+		t.Fatalf("expected %s to have status %+v, got %+v: %s", name, expected, status, err)
+	}
+}
+
+func newDynamicClient() *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		Resource:    Kind + "List",
+		deployments: "DeploymentList",
+	})
+}
+
+func TestController(t *testing.T) {
+	dynamicClient := newDynamicClient()
+
+	for _, d := range []*unstructured.Unstructured{deployment("web", 1), deployment("api", 1), deployment("worker", 3)} {
+		if err := dynamicClient.Tracker().Create(deployments, d, d.GetNamespace()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e := engine.NewEngine(fake.NewSimpleClientset(), dynamicClient)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go e.Run(ctx, "", 0)
+	go NewController(dynamicClient, e, 10*time.Millisecond).Run(ctx)
+
+	valid := klintRule("deployments-need-two-replicas", map[string]interface{}{
+		"target":     map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment"},
+		"expression": "object.spec.replicas >= 2",
+		"severity":   "critical",
+	})
+	invalid := klintRule("broken", map[string]interface{}{
+		"target":     map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment"},
+		"expression": "object.spec.replicas >=",
+	})
+
+	for _, obj := range []*unstructured.Unstructured{valid, invalid} {
+		if _, err := dynamicClient.Resource(Resource).Create(ctx, obj, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitForStatus(t, dynamicClient, "deployments-need-two-replicas", Status{ObservedGeneration: 1, Violations: 2})
+
+	broken, _ := dynamicClient.Resource(Resource).Get(ctx, "broken", metav1.GetOptions{})
+	if status, _, _ := unstructured.NestedString(broken.Object, "status", "error"); status == "" {
+		t.Fatalf("expected an error in the status of an invalid KlintRule, got %v", broken.Object["status"])
+	}
+
+	rules := e.Rules()
+	if len(rules) != 1 || rules[0].Name != "deployments-need-two-replicas" || rules[0].Severity != engine.SeverityCritical {
+		t.Fatalf("expected the valid KlintRule to be loaded, got %v", rules)
+	}
+	if rules[0].Id != "klintrule/deployments-need-two-replicas" {
+		t.Fatalf("expected the KlintRule's rule id to be kept apart from config rules, got %s", rules[0].Id)
+	}
+
+	if err := dynamicClient.Resource(Resource).Delete(ctx, valid.GetName(), metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return len(e.Rules()) == 0, nil
+	})
+	if err != nil {
+		t.Fatalf("expected the deleted KlintRule's rule to be removed, got %v", e.Rules())
+	}
+}
+
+func TestControllerOnlyWritesStatusWhenLeading(t *testing.T) {
+	dynamicClient := newDynamicClient()
+
+	e := engine.NewEngine(fake.NewSimpleClientset(), dynamicClient)
+	e.SetLeading(false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go e.Run(ctx, "", 0)
+	go NewController(dynamicClient, e, 10*time.Millisecond).Run(ctx)
+
+	rule := klintRule("deployments-need-two-replicas", map[string]interface{}{
+		"target":     map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment"},
+		"expression": "object.spec.replicas >= 2",
+	})
+	if _, err := dynamicClient.Resource(Resource).Create(ctx, rule, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return len(e.Rules()) == 1, nil
+	})
+	if err != nil {
+		t.Fatal("expected the KlintRule to be loaded on standby")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	obj, _ := dynamicClient.Resource(Resource).Get(ctx, rule.GetName(), metav1.GetOptions{})
+	if _, ok := obj.Object["status"]; ok {
+		t.Fatalf("expected no status to be written on standby, got %v", obj.Object["status"])
+	}
+
+	e.SetLeading(true)
+	waitForStatus(t, dynamicClient, rule.GetName(), Status{ObservedGeneration: 1})
+}
@@ -0,0 +1,91 @@
+// Package klintrule turns KlintRule custom resources into CEL rules, so that
+// policy can be managed in the cluster alongside everything else rather than
+// in klint's config.
+package klintrule
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/uswitch/klint/config"
+)
+
+// Resource is the cluster-scoped resource KlintRules are stored as.
+var Resource = schema.GroupVersionResource{Group: "klint.uswitch.com", Version: "v1alpha1", Resource: "klintrules"}
+
+const Kind = "KlintRule"
+
+// Spec is what a KlintRule checks. It's a CEL rule named after the object,
+// e.g.
+//
+//	apiVersion: klint.uswitch.com/v1alpha1
+//	kind: KlintRule
+//	metadata:
+//	  name: deployments-need-two-replicas
+//	spec:
+//	  target:
+//	    apiVersion: apps/v1
+//	    kind: Deployment
+//	  matchConditions:
+//	  - name: not-kube-system
+//	    expression: object.metadata.namespace != 'kube-system'
+//	  expression: object.spec.replicas >= 2
+//	  message: "{{ .object.metadata.name }} should run at least 2 replicas"
+//	  severity: warning
+type Spec struct {
+	Description     string                  `json:"description,omitempty"`
+	Severity        string                  `json:"severity,omitempty"`
+	DocsURL         string                  `json:"docsURL,omitempty"`
+	Target          config.Resource         `json:"target"`
+	MatchConditions []config.MatchCondition `json:"matchConditions,omitempty"`
+	Expression      string                  `json:"expression"`
+	Message         string                  `json:"message,omitempty"`
+}
+
+// Status is written back by the controller. Violations is how many objects
+// currently break the rule, and Error why the rule couldn't be loaded.
+type Status struct {
+	ObservedGeneration int64  `json:"observedGeneration,omitempty"`
+	Violations         int    `json:"violations"`
+	Error              string `json:"error,omitempty"`
+}
+
+// KlintRule is the part of the object the controller reads.
+type KlintRule struct {
+	Name       string
+	Generation int64
+	Spec       Spec
+	Status     Status
+}
+
+func fromUnstructured(u *unstructured.Unstructured) (*KlintRule, error) {
+	rule := &KlintRule{Name: u.GetName(), Generation: u.GetGeneration()}
+
+	if spec, ok := u.Object["spec"].(map[string]interface{}); ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(spec, &rule.Spec); err != nil {
+			return rule, err
+		}
+	}
+
+	if status, ok := u.Object["status"].(map[string]interface{}); ok {
+		// a status we can't read is rewritten, so there's no need to fail
+		_ = runtime.DefaultUnstructuredConverter.FromUnstructured(status, &rule.Status)
+	}
+
+	return rule, nil
+}
+
+// CELRule is the config for the CEL rule the KlintRule describes.
+func (k *KlintRule) CELRule() config.CELRule {
+	return config.CELRule{
+		Name:            k.Name,
+		Description:     k.Spec.Description,
+		Severity:        k.Spec.Severity,
+		DocsURL:         k.Spec.DocsURL,
+		Resource:        k.Spec.Target,
+		MatchConditions: k.Spec.MatchConditions,
+		Expression:      k.Spec.Expression,
+		Message:         k.Spec.Message,
+	}
+}
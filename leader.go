@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// runLeaderElection campaigns for the Lease until ctx is done, calling lead
+// with a context that's cancelled when leadership is lost and follow once
+// it has been. Losing the Lease puts this replica back on standby rather
+// than stopping it. The Lease is released when ctx is done so that another
+// replica can take over straight away.
+func runLeaderElection(ctx context.Context, opts *options, client kubernetes.Interface, lead func(context.Context), follow func()) {
+	identity, err := os.Hostname()
+	if err != nil {
+		log.Fatalf("error getting hostname for leader election: %s", err)
+	}
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      opts.leaseName,
+			Namespace: opts.leaseNamespace,
+		},
+		Client:     client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+
+	config := leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		Name:            opts.leaseName,
+		LeaseDuration:   opts.leaseDuration,
+		RenewDeadline:   opts.leaseRenewDeadline,
+		RetryPeriod:     opts.leaseRetryPeriod,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				log.Infof("%s is now the leader", identity)
+				lead(ctx)
+			},
+			OnStoppedLeading: func() {
+				log.Infof("%s is no longer the leader", identity)
+				follow()
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					log.Infof("%s is the leader, standing by", leader)
+				}
+			},
+		},
+	}
+
+	for ctx.Err() == nil {
+		elector, err := leaderelection.NewLeaderElector(config)
+		if err != nil {
+			log.Fatalf("error setting up leader election: %s", err)
+		}
+
+		elector.Run(ctx)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/uswitch/klint/lint"
+)
+
+func runLint(opts *options) int {
+	paths := opts.lintPaths
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	cfg, _ := loadConfig(opts, nil)
+	rules, _ := loadRules(opts, cfg)
+
+	violations, err := lint.NewLinter(rules).LintPaths(paths, os.Stdin)
+	if err != nil {
+		log.Errorf("error linting manifests: %s", err)
+		return 2
+	}
+
+	for _, violation := range violations {
+		fmt.Println(violation)
+	}
+
+	if len(violations) > 0 {
+		return 1
+	}
+
+	return 0
+}
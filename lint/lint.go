@@ -0,0 +1,169 @@
+// Package lint runs klint's rules against manifests on disk rather than
+// objects in a cluster.
+package lint
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"github.com/uswitch/klint/engine"
+)
+
+// Violation is an alert raised against an object read from Source.
+type Violation struct {
+	Source    string
+	Kind      string
+	Namespace string
+	Name      string
+	Alert     *engine.Alert
+}
+
+func (v Violation) String() string {
+	name := v.Name
+	if v.Namespace != "" {
+		name = v.Namespace + "/" + v.Name
+	}
+
+	return fmt.Sprintf("%s: %s %s: [%s] %s", v.Source, v.Kind, name, v.Alert.Rule.Name, v.Alert.Message)
+}
+
+type Linter struct {
+	rules []*engine.Rule
+}
+
+func NewLinter(rules []*engine.Rule) *Linter {
+	return &Linter{rules: rules}
+}
+
+func isManifest(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// LintPaths lints every manifest in paths. Directories are walked for .yaml,
+// .yml and .json files and "-" reads from stdin.
+func (l *Linter) LintPaths(paths []string, stdin io.Reader) ([]Violation, error) {
+	violations := []Violation{}
+
+	for _, path := range paths {
+		if path == "-" {
+			found, err := l.Lint("<stdin>", stdin)
+			if err != nil {
+				return nil, err
+			}
+			violations = append(violations, found...)
+			continue
+		}
+
+		err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			// files named explicitly are linted whatever they are called
+			if info.IsDir() || (file != path && !isManifest(file)) {
+				return nil
+			}
+
+			f, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			found, err := l.Lint(file, f)
+			if err != nil {
+				return err
+			}
+			violations = append(violations, found...)
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return violations, nil
+}
+
+// Lint decodes every YAML or JSON document in r and runs the rules against
+// each object as though it had just been created.
+func (l *Linter) Lint(source string, r io.Reader) ([]Violation, error) {
+	decoder := yaml.NewYAMLOrJSONDecoder(r, 4096)
+	violations := []Violation{}
+
+	for {
+		raw := runtime.RawExtension{}
+		if err := decoder.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %s", source, err)
+		}
+
+		if len(raw.Raw) == 0 { // empty document
+			continue
+		}
+
+		found, err := l.lintRaw(source, raw.Raw)
+		if err != nil {
+			return nil, err
+		}
+		violations = append(violations, found...)
+	}
+
+	return violations, nil
+}
+
+func (l *Linter) lintRaw(source string, raw []byte) ([]Violation, error) {
+	obj, gvk, err := scheme.Codecs.UniversalDeserializer().Decode(raw, nil, nil)
+	if runtime.IsNotRegisteredError(err) { // a custom resource, which only dynamic Wants accept
+		obj, gvk, err = unstructured.UnstructuredJSONScheme.Decode(raw, nil, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", source, err)
+	}
+
+	if list, ok := obj.(*v1.List); ok {
+		violations := []Violation{}
+		for _, item := range list.Items {
+			found, err := l.lintRaw(source, item.Raw)
+			if err != nil {
+				return nil, err
+			}
+			violations = append(violations, found...)
+		}
+		return violations, nil
+	}
+
+	metaObj, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", source, err)
+	}
+
+	violations := []Violation{}
+	for _, alert := range engine.Evaluate(l.rules, nil, nil, obj) {
+		violations = append(violations, Violation{
+			Source:    source,
+			Kind:      gvk.Kind,
+			Namespace: metaObj.GetNamespace(),
+			Name:      metaObj.GetName(),
+			Alert:     alert,
+		})
+	}
+
+	return violations, nil
+}
@@ -0,0 +1,86 @@
+package lint
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uswitch/klint/engine"
+	"github.com/uswitch/klint/rules"
+)
+
+const manifests = `
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: backup
+  namespace: jobs
+spec:
+  schedule: "@daily"
+  successfulJobsHistoryLimit: 3
+  failedJobsHistoryLimit: 3
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+            - name: backup
+              image: backup
+---
+# nothing to see here
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: web
+  namespace: frontend
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: unknown
+`
+
+func TestLint(t *testing.T) {
+	linter := NewLinter([]*engine.Rule{rules.RequireCronJobHistoryLimits, rules.IngressNeedsAnnotation})
+
+	violations, err := linter.Lint("manifests.yaml", strings.NewReader(manifests))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(violations) != 1 {
+		t.Fatalf("expected 1 violation, got %v", violations)
+	}
+
+	if got := violations[0].String(); !strings.HasPrefix(got, "manifests.yaml: Ingress frontend/web: ") {
+		t.Fatalf("unexpected violation %q", got)
+	}
+}
+
+func TestLintPaths(t *testing.T) {
+	dir := t.TempDir()
+
+	deployment := `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "web"},
+	  "spec": {"template": {"spec": {"containers": [{"name": "app"}]}}}}`
+
+	if err := os.WriteFile(filepath.Join(dir, "deployment.json"), []byte(deployment), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a manifest"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	linter := NewLinter([]*engine.Rule{rules.ResourceAnnotationRule})
+
+	violations, err := linter.LintPaths([]string{dir}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(violations) != 1 || violations[0].Kind != "Deployment" {
+		t.Fatalf("expected 1 Deployment violation, got %v", violations)
+	}
+}
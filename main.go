@@ -2,28 +2,72 @@ package main
 
 import (
 	"context"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"gopkg.in/alecthomas/kingpin.v2"
 
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 
-	"github.com/uswitch/klint/alerts"
 	"github.com/uswitch/klint/engine"
-	"github.com/uswitch/klint/rules"
+	"github.com/uswitch/klint/klintrule"
 )
 
 type options struct {
-	kubeconfig string
-	namespace  string
-	debug      bool
-	slackToken string
-	awsRegion  string
-	ageLimit   int
-	jsonFormat bool
+	kubeconfig     string
+	namespace      string
+	debug          bool
+	slackToken     string
+	opsgenieAPIKey string
+	awsRegion      string
+	ageLimit       int
+	jsonFormat     bool
+	lintPaths      []string
+
+	configPath           string
+	configMap            string
+	configMapKey         string
+	configReloadInterval time.Duration
+
+	auditNotify bool
+
+	klintRules              bool
+	klintRuleStatusInterval time.Duration
+
+	dedupStore     string
+	dedupConfigMap string
+	dedupSize      int
+	dedupTTL       time.Duration
+	repeatInterval time.Duration
+
+	leaderElect        bool
+	leaseName          string
+	leaseNamespace     string
+	leaseDuration      time.Duration
+	leaseRenewDeadline time.Duration
+	leaseRetryPeriod   time.Duration
+
+	shutdownTimeout  time.Duration
+	outputAttempts   int
+	outputBackoff    time.Duration
+	outputMaxBackoff time.Duration
+	deadLetter       string
+	workers          int
+	ruleTimeout      time.Duration
+	httpAddress      string
+
+	admissionAddress string
+	admissionCert    string
+	admissionKey     string
+	admissionDeny    []string
 }
 
 func createClientConfig(opts *options) (*rest.Config, error) {
@@ -48,10 +92,50 @@ func main() {
 	kingpin.Flag("age-limit", "Will discard updates for resources old than n minutes. 0 disables").Default("5").IntVar(&opts.ageLimit)
 	kingpin.Flag("debug", "Debug mode").BoolVar(&opts.debug)
 	kingpin.Flag("slack-token", "").Envar("SLACK_TOKEN").StringVar(&opts.slackToken)
+	kingpin.Flag("opsgenie-api-key", "Opsgenie API key, enabling the opsgenie output").Envar("OPSGENIE_API_KEY").StringVar(&opts.opsgenieAPIKey)
 	kingpin.Flag("aws-region", "").Envar("AWS_REGION").Default("eu-west-1").StringVar(&opts.awsRegion)
 	kingpin.Flag("json", "Output log data in JSON format").Default("false").BoolVar(&opts.jsonFormat)
+	kingpin.Flag("config", "Path to a YAML file enabling, disabling and configuring rules").Envar("KLINT_CONFIG").StringVar(&opts.configPath)
+	kingpin.Flag("config-map", "Read the config from a ConfigMap, given as namespace/name, instead of a file").StringVar(&opts.configMap)
+	kingpin.Flag("config-map-key", "Key of the config in the ConfigMap").Default("config.yaml").StringVar(&opts.configMapKey)
+	kingpin.Flag("config-reload-interval", "How often to check the config file for changes. 0 disables checking it; a ConfigMap is always watched").Default("30s").DurationVar(&opts.configReloadInterval)
+	kingpin.Flag("shutdown-timeout", "How long to wait for alerts that are on their way to be sent before exiting").Default(engine.DefaultDrainTimeout.String()).DurationVar(&opts.shutdownTimeout)
+	kingpin.Flag("output-attempts", "How many times to try sending each alert to an output").Default(strconv.Itoa(engine.DefaultDeliveryPolicy.Attempts)).IntVar(&opts.outputAttempts)
+	kingpin.Flag("output-backoff", "How long to wait before the first retry, doubling each time after").Default(engine.DefaultDeliveryPolicy.Backoff.String()).DurationVar(&opts.outputBackoff)
+	kingpin.Flag("output-max-backoff", "Longest to wait between retries").Default(engine.DefaultDeliveryPolicy.MaxBackoff.String()).DurationVar(&opts.outputMaxBackoff)
+	kingpin.Flag("dead-letter", "File to append alerts that couldn't be sent to as JSON, or - for stdout").StringVar(&opts.deadLetter)
+
+	runCmd := kingpin.Command("run", "Watch the cluster and alert on objects that break the rules").Default()
+	runCmd.Flag("klint-rules", "Also load rules from KlintRule objects in the cluster").BoolVar(&opts.klintRules)
+	runCmd.Flag("klint-rule-status-interval", "How often to update the violation counts in KlintRule statuses").Default("1m").DurationVar(&opts.klintRuleStatusInterval)
+	runCmd.Flag("dedup-store", "Where to remember which alerts have been sent: memory, or configmap to survive restarts").Default("memory").EnumVar(&opts.dedupStore, "memory", "configmap")
+	runCmd.Flag("dedup-config-map", "ConfigMap, as namespace/name, used by --dedup-store=configmap").Default("kube-system/klint-state").StringVar(&opts.dedupConfigMap)
+	runCmd.Flag("dedup-size", "Most objects to remember alerts for").Default(strconv.Itoa(engine.DefaultStoreSize)).IntVar(&opts.dedupSize)
+	runCmd.Flag("dedup-ttl", "How long to remember alerts for an object that hasn't changed").Default(engine.DefaultStoreTTL.String()).DurationVar(&opts.dedupTTL)
+	runCmd.Flag("repeat-interval", "How often to send a violation again while it's still firing, unless the config says otherwise. 0 sends it once").Default("24h").DurationVar(&opts.repeatInterval)
+	runCmd.Flag("leader-elect", "Only send alerts while holding a Lease, so that several replicas can run").BoolVar(&opts.leaderElect)
+	runCmd.Flag("leader-elect-lease-name", "Name of the Lease used for leader election").Default("klint").StringVar(&opts.leaseName)
+	runCmd.Flag("leader-elect-lease-namespace", "Namespace of the Lease used for leader election").Default("kube-system").StringVar(&opts.leaseNamespace)
+	runCmd.Flag("leader-elect-lease-duration", "How long replicas on standby wait before taking over the Lease").Default("15s").DurationVar(&opts.leaseDuration)
+	runCmd.Flag("leader-elect-renew-deadline", "How long the leader keeps trying to renew the Lease before giving up").Default("10s").DurationVar(&opts.leaseRenewDeadline)
+	runCmd.Flag("leader-elect-retry-period", "How often to try to acquire or renew the Lease").Default("2s").DurationVar(&opts.leaseRetryPeriod)
+	runCmd.Flag("workers", "How many objects to run the rules against at once").Default(strconv.Itoa(engine.DefaultWorkers)).IntVar(&opts.workers)
+	runCmd.Flag("rule-timeout", "How long rules have for each API call they make, such as fetching logs").Default(engine.DefaultRuleTimeout.String()).DurationVar(&opts.ruleTimeout)
+	runCmd.Flag("http-address", "Address to serve /metrics, /healthz and /readyz on").Default(":9090").StringVar(&opts.httpAddress)
+
+	lintCmd := kingpin.Command("lint", "Check manifests against the rules, exiting non-zero if any are broken")
+	lintCmd.Flag("filename", "Manifest file or directory to lint. Reads stdin if not given").Short('f').StringsVar(&opts.lintPaths)
 
-	kingpin.Parse()
+	auditCmd := kingpin.Command("audit", "Report every object in the cluster that currently breaks the rules")
+	auditCmd.Flag("notify", "Also send the violations to the outputs annotated on each object").BoolVar(&opts.auditNotify)
+
+	admissionCmd := kingpin.Command("admission", "Serve a validating admission webhook that runs the rules")
+	admissionCmd.Flag("listen-address", "Address to serve the webhook on").Default(":8443").StringVar(&opts.admissionAddress)
+	admissionCmd.Flag("tls-cert-file", "Path to the TLS certificate").Required().StringVar(&opts.admissionCert)
+	admissionCmd.Flag("tls-private-key-file", "Path to the TLS private key").Required().StringVar(&opts.admissionKey)
+	admissionCmd.Flag("deny", "Name of a rule that should reject objects rather than warn. Repeatable").StringsVar(&opts.admissionDeny)
+
+	command := kingpin.Parse()
 
 	if opts.debug {
 		log.SetLevel(log.DebugLevel)
@@ -64,6 +148,19 @@ func main() {
 		log.SetFormatter(&log.JSONFormatter{})
 	}
 
+	switch command {
+	case lintCmd.FullCommand():
+		os.Exit(runLint(opts))
+	case auditCmd.FullCommand():
+		runAudit(opts)
+	case admissionCmd.FullCommand():
+		runAdmission(opts)
+	case runCmd.FullCommand():
+		run(opts)
+	}
+}
+
+func newClients(opts *options) (kubernetes.Interface, dynamic.Interface) {
 	config, err := createClientConfig(opts)
 	if err != nil {
 		log.Fatalf("error creating client config: %s", err)
@@ -74,22 +171,163 @@ func main() {
 		log.Fatalf("error creating client: %s", err)
 	}
 
-	executionContext, stop := context.WithCancel(context.Background())
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		log.Fatalf("error creating dynamic client: %s", err)
+	}
+
+	return clientSet, dynamicClient
+}
+
+// newEngine builds an engine with the rules from the config, and its outputs
+// when it's going to send alerts.
+func newEngine(opts *options, clientSet kubernetes.Interface, dynamicClient dynamic.Interface, sending bool) (*engine.Engine, []byte) {
+	cfg, data := loadConfig(opts, clientSet)
+	rules, repeat := loadRules(opts, cfg)
+
+	engine := engine.NewEngine(clientSet, dynamicClient)
+
+	for _, rule := range rules {
+		engine.AddRule(rule)
+	}
+
+	if sending {
+		for _, output := range loadOutputs(opts, cfg) {
+			engine.AddOutput(output)
+		}
+	}
+
+	engine.SetRepeatPolicy(repeat)
+
+	engine.SetDeliveryPolicy(engineDeliveryPolicy(opts))
+	if deadLetter := newDeadLetter(opts); deadLetter != nil {
+		engine.SetDeadLetter(deadLetter)
+	}
+
+	return engine, data
+}
+
+func engineDeliveryPolicy(opts *options) engine.DeliveryPolicy {
+	if opts.outputAttempts < 1 {
+		log.Fatalf("--output-attempts must be at least 1")
+	}
+
+	return engine.DeliveryPolicy{
+		Attempts:   opts.outputAttempts,
+		Backoff:    opts.outputBackoff,
+		MaxBackoff: opts.outputMaxBackoff,
+	}
+}
+
+func newDeadLetter(opts *options) engine.DeadLetter {
+	switch opts.deadLetter {
+	case "":
+		return nil
+	case "-":
+		return engine.NewJSONDeadLetter(os.Stdout)
+	}
+
+	file, err := os.OpenFile(opts.deadLetter, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Fatalf("error opening dead letter file: %s", err)
+	}
+	return engine.NewJSONDeadLetter(file)
+}
+
+// storeFlushInterval is how often a persistent dedup store is saved.
+const storeFlushInterval = 30 * time.Second
+
+func newStore(ctx context.Context, opts *options, clientSet kubernetes.Interface) engine.Store {
+	if opts.dedupStore == "memory" {
+		return engine.NewMemoryStore(opts.dedupSize, opts.dedupTTL)
+	}
+
+	namespace, name, err := splitConfigMap("dedup-config-map", opts.dedupConfigMap)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store := engine.NewConfigMapStore(clientSet, namespace, name, opts.dedupSize, opts.dedupTTL)
+	if err := store.Load(ctx); err != nil {
+		log.Errorf("error loading sent alerts from ConfigMap %s: %s", opts.dedupConfigMap, err)
+	}
+
+	return store
+}
+
+// saveStore saves a persistent store until ctx is done. Only the leader
+// saves, so that replicas don't overwrite each other.
+func saveStore(ctx context.Context, store engine.Store) {
+	if store, ok := store.(*engine.ConfigMapStore); ok {
+		store.Run(ctx, storeFlushInterval)
+	}
+}
+
+// flushStore saves what's left in a persistent store when klint stops.
+func flushStore(store engine.Store) {
+	if store, ok := store.(*engine.ConfigMapStore); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := store.Flush(ctx); err != nil {
+			log.Errorf("error saving sent alerts to ConfigMap: %s", err)
+		}
+	}
+}
+
+func run(opts *options) {
+	executionContext, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	engine := engine.NewEngine(clientSet)
+	if opts.workers < 1 {
+		log.Fatalf("--workers must be at least 1")
+	}
+
+	clientSet, dynamicClient := newClients(opts)
+	engine, data := newEngine(opts, clientSet, dynamicClient, true)
+	go serveHTTP(opts.httpAddress, engine)
+	engine.SetDrainTimeout(opts.shutdownTimeout)
+	engine.SetWorkers(opts.workers)
+	engine.SetRuleTimeout(opts.ruleTimeout)
+
+	store := newStore(executionContext, opts, clientSet)
+	engine.SetStore(store)
+
+	// the Lease outlives the engine, so that alerts still on their way when
+	// klint is stopped are sent and saved before another replica takes over
+	finalContext, finish := context.WithCancel(context.Background())
+
+	elected := make(chan struct{})
+	if opts.leaderElect {
+		engine.SetLeading(false)
+		go func() {
+			defer close(elected)
+			runLeaderElection(finalContext, opts, clientSet,
+				func(ctx context.Context) {
+					engine.SetLeading(true)
+					saveStore(ctx, store)
+				},
+				func() { engine.SetLeading(false) },
+			)
+		}()
+	} else {
+		close(elected)
+		go saveStore(finalContext, store)
+	}
 
-	engine.AddRule(rules.UnsuccessfulExitRule)
-	engine.AddRule(rules.ResourceAnnotationRule)
-	engine.AddRule(rules.ScrapeNeedsPortsRule)
-	engine.AddRule(rules.RequireCronJobHistoryLimits)
-	engine.AddRule(rules.IngressNeedsAnnotation)
+	go watchConfig(executionContext, opts, clientSet, data, engine)
 
-	if len(opts.slackToken) > 0 {
-		engine.AddOutput(alerts.NewSlackOutput(opts.slackToken))
+	if opts.klintRules {
+		go klintrule.NewController(dynamicClient, engine, opts.klintRuleStatusInterval).Run(executionContext)
 	}
-	engine.AddOutput(alerts.NewSNSOutput(opts.awsRegion))
 
-	go engine.Run(executionContext, opts.namespace, opts.ageLimit)
-	select {}
+	engine.Run(executionContext, opts.namespace, opts.ageLimit)
+
+	// a replica that's lost the Lease leaves saving to the new leader
+	if engine.Leading() {
+		flushStore(store)
+	}
+	finish()
+	<-elected
+	log.Infof("Stopped")
 }
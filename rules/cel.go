@@ -0,0 +1,182 @@
+package rules
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/google/cel-go/cel"
+	log "github.com/sirupsen/logrus"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/uswitch/klint/config"
+	"github.com/uswitch/klint/engine"
+)
+
+// celCostLimit stops runaway expressions, e.g. nested comprehensions over
+// large lists, from holding up the engine.
+const celCostLimit = 1000000
+
+var celEnv, celEnvErr = cel.NewEnv(
+	cel.Variable("object", cel.DynType),
+	cel.Variable("oldObject", cel.DynType),
+)
+
+func parseSeverity(severity string) (engine.Severity, error) {
+	switch s := engine.Severity(severity); s {
+	case "", engine.SeverityInfo, engine.SeverityWarning, engine.SeverityCritical:
+		return s, nil
+	}
+	return "", fmt.Errorf("severity must be one of info, warning or critical, not %q", severity)
+}
+
+func celWant(resource config.Resource) (engine.Want, error) {
+	if resource.APIVersion == "" || resource.Kind == "" {
+		return engine.Want{}, fmt.Errorf("resource needs an apiVersion and kind")
+	}
+
+	gv, err := schema.ParseGroupVersion(resource.APIVersion)
+	if err != nil {
+		return engine.Want{}, fmt.Errorf("resource.apiVersion: %s", err)
+	}
+
+	gvr, _ := meta.UnsafeGuessKindToResource(gv.WithKind(resource.Kind))
+	if resource.Resource != "" {
+		gvr.Resource = resource.Resource
+	}
+
+	return engine.WantResource(gvr, resource.Kind), nil
+}
+
+func celProgram(expression string) (cel.Program, error) {
+	if celEnvErr != nil {
+		return nil, celEnvErr
+	}
+
+	if strings.TrimSpace(expression) == "" {
+		return nil, fmt.Errorf("expression must be set")
+	}
+
+	ast, issues := celEnv.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("expression: %s", issues.Err())
+	}
+
+	if t := ast.OutputType(); t != cel.BoolType && t != cel.DynType {
+		return nil, fmt.Errorf("expression must evaluate to a bool, not %s", t)
+	}
+
+	return celEnv.Program(ast, cel.CostLimit(celCostLimit))
+}
+
+func evalBool(program cel.Program, vars map[string]interface{}) (bool, error) {
+	result, _, err := program.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := result.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("evaluated to %v, not a bool", result.Value())
+	}
+	return b, nil
+}
+
+// celVars are the variables given to a CEL rule's expression and message.
+func celVars(old, new runtime.Object) map[string]interface{} {
+	vars := map[string]interface{}{"object": new.(*unstructured.Unstructured).Object, "oldObject": nil}
+	if old != nil {
+		vars["oldObject"] = old.(*unstructured.Unstructured).Object
+	}
+	return vars
+}
+
+// NewCELRule creates a rule from its config. Objects that don't meet the
+// match conditions are ignored. The rest are fine if the expression is true;
+// otherwise an alert is raised with the rendered message. Expressions that
+// fail to evaluate, e.g. because they read a field the object doesn't have
+// without checking with has(), are logged.
+func NewCELRule(spec config.CELRule) (*engine.Rule, error) {
+	if spec.Name == "" {
+		return nil, fmt.Errorf("name must be set")
+	}
+
+	severity, err := parseSeverity(spec.Severity)
+	if err != nil {
+		return nil, err
+	}
+
+	want, err := celWant(spec.Resource)
+	if err != nil {
+		return nil, err
+	}
+
+	program, err := celProgram(spec.Expression)
+	if err != nil {
+		return nil, err
+	}
+
+	conditions := make([]cel.Program, len(spec.MatchConditions))
+	for i, condition := range spec.MatchConditions {
+		if conditions[i], err = celProgram(condition.Expression); err != nil {
+			return nil, fmt.Errorf("matchConditions[%d] (%s): %s", i, condition.Name, err)
+		}
+	}
+
+	message := spec.Message
+	if message == "" {
+		message = fmt.Sprintf("{{ .object.metadata.name }} doesn't satisfy %s", spec.Expression)
+	}
+	messageTemplate, err := template.New(spec.Name).Parse(message)
+	if err != nil {
+		return nil, fmt.Errorf("message: %s", err)
+	}
+
+	return engine.NewRule(
+		engine.RuleMeta{
+			Name:        spec.Name,
+			Description: spec.Description,
+			Severity:    severity,
+			DocsURL:     spec.DocsURL,
+		},
+		func(old runtime.Object, new runtime.Object, ctx *engine.RuleHandlerContext) {
+			obj := new.(*unstructured.Unstructured)
+			logger := log.WithFields(log.Fields{"name": obj.GetName(), "namespace": obj.GetNamespace(), "rule": spec.Name})
+			vars := celVars(old, new)
+
+			for i, condition := range conditions {
+				matched, err := evalBool(condition, vars)
+				if err != nil {
+					logger.Warnf("error evaluating match condition %s: %s", spec.MatchConditions[i].Name, err)
+					return
+				}
+				if !matched {
+					return
+				}
+			}
+
+			ok, err := evalBool(program, vars)
+			if err != nil {
+				logger.Warnf("error evaluating expression: %s", err)
+				return
+			}
+			if ok {
+				return
+			}
+
+			out := &bytes.Buffer{}
+			if err := messageTemplate.Execute(out, vars); err != nil {
+				logger.Warnf("error rendering message: %s", err)
+				return
+			}
+
+			ctx.Alert(new, out.String())
+		},
+		want,
+	), nil
+}
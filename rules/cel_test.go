@@ -0,0 +1,175 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/uswitch/klint/config"
+	"github.com/uswitch/klint/engine"
+	"github.com/uswitch/klint/engine/enginetest"
+)
+
+func replicas(d *appsv1.Deployment, n int32) *appsv1.Deployment {
+	d.Spec.Replicas = &n
+	return d
+}
+
+func TestCELRule(t *testing.T) {
+	cfg := mustParse(t, `
+celRules:
+- name: DeploymentsNeedTwoReplicas
+  severity: critical
+  resource:
+    apiVersion: apps/v1
+    kind: Deployment
+  expression: object.spec.replicas >= 2
+  message: "{{ .object.metadata.name }} runs {{ .object.spec.replicas }} replica"
+`)
+
+	enabled, err := FromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rule := enabled[len(enabled)-1]
+	if rule.Name != "DeploymentsNeedTwoReplicas" || rule.Severity != engine.SeverityCritical {
+		t.Fatalf("unexpected rule %v", rule.RuleMeta)
+	}
+
+	alerts := engine.Evaluate([]*engine.Rule{rule}, nil, nil, replicas(deployment("web"), 3))
+	if len(alerts) != 0 {
+		t.Fatalf("expected no alerts, got %v", alerts)
+	}
+
+	alerts = engine.Evaluate([]*engine.Rule{rule}, nil, nil, replicas(deployment("web"), 1))
+	if len(alerts) != 1 || alerts[0].Message != "web runs 1 replica" {
+		t.Fatalf("expected an alert, got %v", alerts)
+	}
+}
+
+func TestCELRuleOldObject(t *testing.T) {
+	rule, err := NewCELRule(config.CELRule{
+		Name:       "ReplicasOnlyGrow",
+		Resource:   config.Resource{APIVersion: "apps/v1", Kind: "Deployment"},
+		Expression: "oldObject == null || object.spec.replicas >= oldObject.spec.replicas",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if alerts := engine.Evaluate([]*engine.Rule{rule}, nil, nil, replicas(deployment("web"), 1)); len(alerts) != 0 {
+		t.Fatalf("expected no alerts for a new object, got %v", alerts)
+	}
+
+	alerts := engine.Evaluate([]*engine.Rule{rule}, nil, replicas(deployment("web"), 3), replicas(deployment("web"), 2))
+	if len(alerts) != 1 || !strings.HasPrefix(alerts[0].Message, "web doesn't satisfy") {
+		t.Fatalf("expected an alert, got %v", alerts)
+	}
+}
+
+func TestCELRuleIgnoresEvaluationErrors(t *testing.T) {
+	rule, err := NewCELRule(config.CELRule{
+		Name:       "NeedsTeamLabel",
+		Resource:   config.Resource{APIVersion: "apps/v1", Kind: "Deployment"},
+		Expression: "object.metadata.labels.team != ''",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// deployment has no labels, so the expression can't be evaluated
+	if alerts := engine.Evaluate([]*engine.Rule{rule}, nil, nil, deployment("web")); len(alerts) != 0 {
+		t.Fatalf("expected no alerts, got %v", alerts)
+	}
+}
+
+func TestCELRuleCustomResource(t *testing.T) {
+	rule, err := NewCELRule(config.CELRule{
+		Name:       "CertificateNeedsSecret",
+		Resource:   config.Resource{APIVersion: "cert-manager.io/v1", Kind: "Certificate"},
+		Expression: "has(object.spec.secretName)",
+		Message:    "{{ .object.metadata.name }} has no secretName",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := rule.Wants[0]; want.Resource.Resource != "certificates" {
+		t.Fatalf("expected the resource to be guessed, got %v", want.Resource)
+	}
+
+	h := enginetest.New(t, rule)
+
+	certificate := &unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{}}}
+	certificate.SetAPIVersion("cert-manager.io/v1")
+	certificate.SetKind("Certificate")
+	certificate.SetName("tls")
+	h.Create(certificate)
+
+	if alerts := h.WaitForAlerts(1); alerts[0].Alert.Message != "tls has no secretName" {
+		t.Fatalf("unexpected alert %q", alerts[0].Alert.Message)
+	}
+}
+
+func TestCELRuleConfigErrors(t *testing.T) {
+	cfg := mustParse(t, `
+celRules:
+- name: ScrapeNeedsPortsRule
+  resource: {apiVersion: v1, kind: Pod}
+  expression: "true"
+- name: Broken
+  resource: {apiVersion: v1, kind: Pod}
+  expression: "object.spec.containers.size() >"
+- name: NotBool
+  resource: {apiVersion: v1, kind: Pod}
+  expression: "1 + 1"
+- name: NoKind
+  resource: {apiVersion: v1}
+  expression: "true"
+- name: BadSeverity
+  severity: urgent
+  resource: {apiVersion: v1, kind: Pod}
+  expression: "true"
+`)
+
+	_, err := FromConfig(cfg)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, expected := range []string{
+		`celRules[0]: there's already a rule named "ScrapeNeedsPortsRule"`,
+		"celRules[1]: expression:",
+		"celRules[2]: expression must evaluate to a bool",
+		"celRules[3]: resource needs an apiVersion and kind",
+		"celRules[4]: severity must be one of",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in error: %s", expected, err)
+		}
+	}
+}
+
+func TestCELRuleMatchConditions(t *testing.T) {
+	rule, err := NewCELRule(config.CELRule{
+		Name:     "DeploymentsNeedTwoReplicas",
+		Resource: config.Resource{APIVersion: "apps/v1", Kind: "Deployment"},
+		MatchConditions: []config.MatchCondition{
+			{Name: "not-canary", Expression: "!object.metadata.name.endsWith('-canary')"},
+		},
+		Expression: "object.spec.replicas >= 2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if alerts := engine.Evaluate([]*engine.Rule{rule}, nil, nil, replicas(deployment("web-canary"), 1)); len(alerts) != 0 {
+		t.Fatalf("expected unmatched objects to be ignored, got %v", alerts)
+	}
+	if alerts := engine.Evaluate([]*engine.Rule{rule}, nil, nil, replicas(deployment("web"), 1)); len(alerts) != 1 {
+		t.Fatalf("expected an alert, got %v", alerts)
+	}
+}
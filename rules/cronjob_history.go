@@ -11,37 +11,54 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
-var RequireCronJobHistoryLimits = engine.NewRule(
-	func(old runtime.Object, new runtime.Object, ctx *engine.RuleHandlerContext) {
-		job := new.(*batchv1.CronJob)
-		logger := log.WithFields(log.Fields{"rule": "RequireCronJobHistoryLimits", "namespace": job.GetNamespace(), "name": job.GetName()})
-
-		logger.Debugf("checking for history limit requirement")
-
-		messages := make([]string, 0)
-		if job.Spec.SuccessfulJobsHistoryLimit == nil {
-			message := fmt.Sprintf("CronJob `%s/%s` doesn't specify `.spec.successfulJobsHistoryLimit`. Must be 10 or under.", job.GetNamespace(), job.GetName())
-			messages = append(messages, message)
-		} else {
-			if *job.Spec.SuccessfulJobsHistoryLimit > 10 {
-				message := fmt.Sprintf("CronJob `%s/%s` `.spec.succcessfulJobsHistoryLimit` is too high: `%d`. Must be 10 or under.", job.GetNamespace(), job.GetName(), *job.Spec.SuccessfulJobsHistoryLimit)
-				messages = append(messages, message)
+type CronJobHistoryLimitsParams struct {
+	// MaxHistoryLimit is the highest successful or failed history limit allowed.
+	MaxHistoryLimit int32 `json:"maxHistoryLimit"`
+}
+
+func DefaultCronJobHistoryLimitsParams() CronJobHistoryLimitsParams {
+	return CronJobHistoryLimitsParams{
+		MaxHistoryLimit: 10,
+	}
+}
+
+func (p CronJobHistoryLimitsParams) Validate() error {
+	if p.MaxHistoryLimit < 0 {
+		return fmt.Errorf("maxHistoryLimit must not be negative")
+	}
+	return nil
+}
+
+func NewRequireCronJobHistoryLimits(params CronJobHistoryLimitsParams) *engine.Rule {
+	max := params.MaxHistoryLimit
+
+	return engine.NewRule(
+		engine.RuleMeta{
+			Name:        "RequireCronJobHistoryLimits",
+			Description: fmt.Sprintf("CronJobs should set successful and failed history limits of %d or under.", max),
+			Severity:    engine.SeverityWarning,
+			DocsURL:     "https://github.com/uswitch/klint#requirecronjobhistorylimits",
+		},
+		func(old runtime.Object, new runtime.Object, ctx *engine.RuleHandlerContext) {
+			job := new.(*batchv1.CronJob)
+			logger := log.WithFields(log.Fields{"rule": "RequireCronJobHistoryLimits", "namespace": job.GetNamespace(), "name": job.GetName()})
+
+			logger.Debugf("checking for history limit requirement")
+
+			if job.Spec.SuccessfulJobsHistoryLimit == nil {
+				ctx.AlertKeyf(job, "successfulJobsHistoryLimit", "CronJob `%s/%s` doesn't specify `.spec.successfulJobsHistoryLimit`. Must be %d or under.", job.GetNamespace(), job.GetName(), max)
+			} else if *job.Spec.SuccessfulJobsHistoryLimit > max {
+				ctx.AlertKeyf(job, "successfulJobsHistoryLimit", "CronJob `%s/%s` `.spec.succcessfulJobsHistoryLimit` is too high: `%d`. Must be %d or under.", job.GetNamespace(), job.GetName(), *job.Spec.SuccessfulJobsHistoryLimit, max)
 			}
-		}
-
-		if job.Spec.FailedJobsHistoryLimit == nil {
-			message := fmt.Sprintf("CronJob `%s/%s` doesn't specify `.spec.failedJobsHistoryLimit`. Must be 10 or under.", job.GetNamespace(), job.GetName())
-			messages = append(messages, message)
-		} else {
-			if *job.Spec.FailedJobsHistoryLimit > 10 {
-				message := fmt.Sprintf("CronJob `%s/%s` `.spec.failedJobsHistoryLimit` is too high: `%d`. Must be 10 or under.", job.GetNamespace(), job.GetName(), *job.Spec.FailedJobsHistoryLimit)
-				messages = append(messages, message)
+
+			if job.Spec.FailedJobsHistoryLimit == nil {
+				ctx.AlertKeyf(job, "failedJobsHistoryLimit", "CronJob `%s/%s` doesn't specify `.spec.failedJobsHistoryLimit`. Must be %d or under.", job.GetNamespace(), job.GetName(), max)
+			} else if *job.Spec.FailedJobsHistoryLimit > max {
+				ctx.AlertKeyf(job, "failedJobsHistoryLimit", "CronJob `%s/%s` `.spec.failedJobsHistoryLimit` is too high: `%d`. Must be %d or under.", job.GetNamespace(), job.GetName(), *job.Spec.FailedJobsHistoryLimit, max)
 			}
-		}
+		},
+		engine.WantCronJobs,
+	)
+}
 
-		for _, msg := range messages {
-			ctx.Alert(job, msg)
-		}
-	},
-	engine.WantCronJobs,
-)
+var RequireCronJobHistoryLimits = NewRequireCronJobHistoryLimits(DefaultCronJobHistoryLimitsParams())
@@ -1,6 +1,7 @@
 package rules
 
 import (
+	"fmt"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
@@ -11,24 +12,50 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
-const (
-	prefix = "com.uswitch.heimdall"
-)
+type IngressNeedsAnnotationParams struct {
+	// AnnotationPrefix is the prefix of the annotations that configure alerts.
+	AnnotationPrefix string `json:"annotationPrefix"`
+}
+
+func DefaultIngressNeedsAnnotationParams() IngressNeedsAnnotationParams {
+	return IngressNeedsAnnotationParams{
+		AnnotationPrefix: "com.uswitch.heimdall",
+	}
+}
+
+func (p IngressNeedsAnnotationParams) Validate() error {
+	if p.AnnotationPrefix == "" {
+		return fmt.Errorf("annotationPrefix must be set")
+	}
+	return nil
+}
 
-var IngressNeedsAnnotation = engine.NewRule(
-	func(old runtime.Object, new runtime.Object, ctx *engine.RuleHandlerContext) {
-		ingress := new.(*networkingv1.Ingress)
-		logger := log.WithFields(log.Fields{"name": ingress.Name, "namespace": ingress.Namespace, "rule": "IngressNeedsAnnotation"})
-		annotation := ingress.GetAnnotations()
-		hasAnnotation := false
-		for key := range annotation {
-			if strings.HasPrefix(key, prefix) {
-				logger.Debugf("Checking annotation %s", key)
-				hasAnnotation = true
-				break
+func NewIngressNeedsAnnotation(params IngressNeedsAnnotationParams) *engine.Rule {
+	prefix := params.AnnotationPrefix
+
+	return engine.NewRule(
+		engine.RuleMeta{
+			Name:        "IngressNeedsAnnotation",
+			Description: "Ingresses should have heimdall alerts configured.",
+			Severity:    engine.SeverityInfo,
+			DocsURL:     "https://github.com/uswitch/klint#ingressneedsannotation",
+		},
+		func(old runtime.Object, new runtime.Object, ctx *engine.RuleHandlerContext) {
+			ingress := new.(*networkingv1.Ingress)
+			logger := log.WithFields(log.Fields{"name": ingress.Name, "namespace": ingress.Namespace, "rule": "IngressNeedsAnnotation"})
+			annotation := ingress.GetAnnotations()
+			hasAnnotation := false
+			for key := range annotation {
+				if strings.HasPrefix(key, prefix) {
+					logger.Debugf("Checking annotation %s", key)
+					hasAnnotation = true
+					break
+				}
+			}
+			if !hasAnnotation {
+				ctx.Alertf(new, "You don't have any alerts set up for your ingress: %s.%s. You may want to check https://github.com/uswitch/heimdall for more info.", ingress.Namespace, ingress.Name)
 			}
-		}
-		if !hasAnnotation {
-			ctx.Alertf(new, "You don't have any alerts set up for your ingress: %s.%s. You may want to check https://github.com/uswitch/heimdall for more info.", ingress.Namespace, ingress.Name)
-		}
-	}, engine.WantIngress)
+		}, engine.WantIngress)
+}
+
+var IngressNeedsAnnotation = NewIngressNeedsAnnotation(DefaultIngressNeedsAnnotationParams())
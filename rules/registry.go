@@ -0,0 +1,189 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"github.com/uswitch/klint/config"
+	"github.com/uswitch/klint/engine"
+)
+
+// Builder creates a rule from the params given in its config.
+type Builder func(params json.RawMessage) (*engine.Rule, error)
+
+type validator interface {
+	Validate() error
+}
+
+// decodeParams decodes raw over the defaults already in params, rejecting
+// unknown fields, and validates the result.
+func decodeParams(raw json.RawMessage, params validator) error {
+	if len(raw) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+
+		if err := decoder.Decode(params); err != nil {
+			return err
+		}
+	}
+
+	return params.Validate()
+}
+
+func noParams(rule *engine.Rule) Builder {
+	return func(raw json.RawMessage) (*engine.Rule, error) {
+		if len(raw) > 0 && string(raw) != "null" {
+			return nil, fmt.Errorf("%s doesn't take any params", rule.Name)
+		}
+		return rule, nil
+	}
+}
+
+// names is the order rules are added to the engine in
+var names = []string{
+	"UnsuccessfulExitRule",
+	"ResourceAnnotationRule",
+	"ScrapeNeedsPortsRule",
+	"RequireCronJobHistoryLimits",
+	"IngressNeedsAnnotation",
+}
+
+var builders = map[string]Builder{
+	"UnsuccessfulExitRule": func(raw json.RawMessage) (*engine.Rule, error) {
+		params := DefaultUnsuccessfulExitParams()
+		if err := decodeParams(raw, &params); err != nil {
+			return nil, err
+		}
+		return NewUnsuccessfulExitRule(params), nil
+	},
+	"ResourceAnnotationRule": func(raw json.RawMessage) (*engine.Rule, error) {
+		params := DefaultResourceAnnotationParams()
+		if err := decodeParams(raw, &params); err != nil {
+			return nil, err
+		}
+		return NewResourceAnnotationRule(params), nil
+	},
+	"ScrapeNeedsPortsRule": noParams(ScrapeNeedsPortsRule),
+	"RequireCronJobHistoryLimits": func(raw json.RawMessage) (*engine.Rule, error) {
+		params := DefaultCronJobHistoryLimitsParams()
+		if err := decodeParams(raw, &params); err != nil {
+			return nil, err
+		}
+		return NewRequireCronJobHistoryLimits(params), nil
+	},
+	"IngressNeedsAnnotation": func(raw json.RawMessage) (*engine.Rule, error) {
+		params := DefaultIngressNeedsAnnotationParams()
+		if err := decodeParams(raw, &params); err != nil {
+			return nil, err
+		}
+		return NewIngressNeedsAnnotation(params), nil
+	},
+}
+
+// FromConfig builds the rules enabled in cfg with their params, followed by
+// its CEL rules. Every problem with the config is reported, not just the
+// first.
+func FromConfig(cfg *config.Config) ([]*engine.Rule, error) {
+	errs := []error{}
+
+	unknown := []string{}
+	for name := range cfg.Rules {
+		if _, ok := builders[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		errs = append(errs, fmt.Errorf("rules.%s: unknown rule, expected one of %v", name, names))
+	}
+
+	rules := []*engine.Rule{}
+	for _, name := range names {
+		ruleConfig := cfg.Rules[name]
+		if !ruleConfig.IsEnabled() {
+			continue
+		}
+
+		rule, err := builders[name](ruleConfig.Params)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rules.%s.params: %s", name, err))
+			continue
+		}
+
+		rules = append(rules, rule)
+	}
+
+	seen := map[string]bool{}
+	for i, spec := range cfg.CELRules {
+		if _, ok := builders[spec.Name]; ok || seen[spec.Name] {
+			errs = append(errs, fmt.Errorf("celRules[%d]: there's already a rule named %q", i, spec.Name))
+			continue
+		}
+		seen[spec.Name] = true
+
+		rule, err := NewCELRule(spec)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("celRules[%d]: %s", i, err))
+			continue
+		}
+
+		rules = append(rules, rule)
+	}
+
+	if len(errs) > 0 {
+		return nil, utilerrors.NewAggregate(errs)
+	}
+
+	return rules, nil
+}
+
+// RepeatPolicyFromConfig builds how often violations are sent again from
+// cfg, falling back to interval. Rule names aren't checked, as they can
+// also come from KlintRules.
+func RepeatPolicyFromConfig(cfg *config.Config, interval time.Duration) (engine.RepeatPolicy, error) {
+	errs := []error{}
+	policy := engine.RepeatPolicy{
+		Default:    interval,
+		Severities: map[engine.Severity]time.Duration{},
+		Rules:      map[string]time.Duration{},
+	}
+
+	for _, name := range sortedKeys(cfg.Repeat.Severities) {
+		severity, err := parseSeverity(name)
+		if err == nil && severity == "" {
+			err = fmt.Errorf("severity must be one of info, warning or critical")
+		}
+		if err == nil && cfg.Repeat.Severities[name].Duration < 0 {
+			err = fmt.Errorf("interval must not be negative")
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("repeat.severities.%s: %s", name, err))
+			continue
+		}
+		policy.Severities[severity] = cfg.Repeat.Severities[name].Duration
+	}
+
+	for _, name := range sortedKeys(cfg.Repeat.Rules) {
+		if cfg.Repeat.Rules[name].Duration < 0 {
+			errs = append(errs, fmt.Errorf("repeat.rules.%s: interval must not be negative", name))
+			continue
+		}
+		policy.Rules[name] = cfg.Repeat.Rules[name].Duration
+	}
+
+	return policy, utilerrors.NewAggregate(errs)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,134 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/uswitch/klint/config"
+	"github.com/uswitch/klint/engine"
+)
+
+func mustParse(t *testing.T, data string) *config.Config {
+	cfg, err := config.Parse([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestFromConfigDefaults(t *testing.T) {
+	enabled, err := FromConfig(&config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(enabled) != len(names) {
+		t.Fatalf("expected all %d rules enabled, got %d", len(names), len(enabled))
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	cfg := mustParse(t, `
+rules:
+  IngressNeedsAnnotation:
+    enabled: false
+  RequireCronJobHistoryLimits:
+    params:
+      maxHistoryLimit: 3
+`)
+
+	enabled, err := FromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cronJobRule *engine.Rule
+	for _, rule := range enabled {
+		if rule.Name == "IngressNeedsAnnotation" {
+			t.Fatal("expected IngressNeedsAnnotation to be disabled")
+		}
+		if rule.Name == "RequireCronJobHistoryLimits" {
+			cronJobRule = rule
+		}
+	}
+
+	five := int32(5)
+	job := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "backup"},
+		Spec:       batchv1.CronJobSpec{SuccessfulJobsHistoryLimit: &five, FailedJobsHistoryLimit: &five},
+	}
+
+	alerts := engine.Evaluate([]*engine.Rule{cronJobRule}, nil, nil, job)
+	if len(alerts) != 2 || !strings.Contains(alerts[0].Message, "Must be 3 or under") {
+		t.Fatalf("expected the configured limit to be used, got %v", alerts)
+	}
+}
+
+func TestFromConfigReportsEveryProblem(t *testing.T) {
+	cfg := mustParse(t, `
+rules:
+  NoSuchRule: {}
+  ScrapeNeedsPortsRule:
+    params:
+      port: 80
+  UnsuccessfulExitRule:
+    params:
+      tailLine: 10
+  RequireCronJobHistoryLimits:
+    params:
+      maxHistoryLimit: -1
+`)
+
+	_, err := FromConfig(cfg)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, expected := range []string{"rules.NoSuchRule", "rules.ScrapeNeedsPortsRule.params", `unknown field "tailLine"`, "maxHistoryLimit must not be negative"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in error: %s", expected, err)
+		}
+	}
+}
+
+func TestConfigRejectsUnknownFields(t *testing.T) {
+	if _, err := config.Parse([]byte("rule:\n  IngressNeedsAnnotation: {}\n")); err == nil {
+		t.Fatal("expected an error for an unknown field")
+	}
+}
+
+func TestRepeatPolicyFromConfig(t *testing.T) {
+	cfg := mustParse(t, `
+repeat:
+  severities:
+    critical: 4h
+  rules:
+    IngressNeedsAnnotation: 0s
+`)
+
+	policy, err := RepeatPolicyFromConfig(cfg, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if interval := policy.Interval("IngressNeedsAnnotation", engine.SeverityCritical); interval != 0 {
+		t.Errorf("expected IngressNeedsAnnotation not to repeat, got %s", interval)
+	}
+	if interval := policy.Interval("UnsuccessfulExitRule", engine.SeverityCritical); interval != 4*time.Hour {
+		t.Errorf("expected critical violations to repeat every 4h, got %s", interval)
+	}
+	if interval := policy.Interval("UnsuccessfulExitRule", engine.SeverityWarning); interval != 24*time.Hour {
+		t.Errorf("expected the default for warnings, got %s", interval)
+	}
+
+	_, err = RepeatPolicyFromConfig(mustParse(t, "repeat:\n  severities:\n    urgent: 1h\n    info: -1h\n"), 0)
+	for _, expected := range []string{"repeat.severities.urgent", "repeat.severities.info: interval must not be negative"} {
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in error: %v", expected, err)
+		}
+	}
+}
@@ -1,11 +1,9 @@
 package rules
 
 import (
-	"reflect"
+	"fmt"
 	"strings"
 
-	log "github.com/sirupsen/logrus"
-
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -31,11 +29,32 @@ func podNameForDeployment(deployment *appsv1.Deployment) string {
 	return podName
 }
 
-func containersInViolation(deployment *appsv1.Deployment) []string {
+type ResourceAnnotationParams struct {
+	// Requests are the resources every container must request.
+	Requests []string `json:"requests"`
+	// Limits are the resources every container must be limited on.
+	Limits []string `json:"limits"`
+}
+
+func DefaultResourceAnnotationParams() ResourceAnnotationParams {
+	return ResourceAnnotationParams{
+		Requests: []string{"cpu", "memory"},
+		Limits:   []string{"memory"},
+	}
+}
+
+func (p ResourceAnnotationParams) Validate() error {
+	if len(p.Requests) == 0 && len(p.Limits) == 0 {
+		return fmt.Errorf("at least one of requests or limits must be set")
+	}
+	return nil
+}
+
+func containersInViolation(deployment *appsv1.Deployment, params ResourceAnnotationParams) []string {
 	containersMissingResources := []string{}
 
 	for _, container := range deployment.Spec.Template.Spec.Containers {
-		if !(hasKeys(container.Resources.Requests, "cpu", "memory") && hasKeys(container.Resources.Limits, "memory")) {
+		if !(hasKeys(container.Resources.Requests, params.Requests...) && hasKeys(container.Resources.Limits, params.Limits...)) {
 			containersMissingResources = append(containersMissingResources, container.Name)
 		}
 	}
@@ -43,24 +62,23 @@ func containersInViolation(deployment *appsv1.Deployment) []string {
 	return containersMissingResources
 }
 
-var ResourceAnnotationRule = engine.NewRule(
-	func(old runtime.Object, new runtime.Object, ctx *engine.RuleHandlerContext) {
-		deployment := new.(*appsv1.Deployment)
-		logger := log.WithFields(log.Fields{"rule": "ResourceAnnotationRule", "name": deployment.Name, "namespace": deployment.Namespace})
+func NewResourceAnnotationRule(params ResourceAnnotationParams) *engine.Rule {
+	return engine.NewRule(
+		engine.RuleMeta{
+			Name:        "ResourceAnnotationRule",
+			Description: "Deployment containers should set resource requests and limits.",
+			Severity:    engine.SeverityWarning,
+			DocsURL:     "https://github.com/uswitch/klint#resourceannotationrule",
+		},
+		func(old runtime.Object, new runtime.Object, ctx *engine.RuleHandlerContext) {
+			deployment := new.(*appsv1.Deployment)
 
-		newInViolation := containersInViolation(deployment)
-
-		if old == nil || !reflect.DeepEqual(containersInViolation(old.(*appsv1.Deployment)), newInViolation) {
-			if len(newInViolation) == 0 { // it wasn't zero before so they've fixed their issues
-				if old != nil {
-					ctx.Alertf(new, "Thanks for sorting your resource requests and limits on %s.%s!", deployment.ObjectMeta.Namespace, podNameForDeployment(deployment))
-				}
-			} else { // it's now more or less broken than it was before, but not fixed
-				ctx.Alertf(new, "Please add resource requests and limits to the containers (%s) part of %s.%s", strings.Join(newInViolation, ", "), deployment.ObjectMeta.Namespace, podNameForDeployment(deployment))
+			if inViolation := containersInViolation(deployment, params); len(inViolation) > 0 {
+				ctx.Alertf(new, "Please add resource requests and limits to the containers (%s) part of %s.%s", strings.Join(inViolation, ", "), deployment.ObjectMeta.Namespace, podNameForDeployment(deployment))
 			}
-		} else {
-			logger.Debugf("ResourceAnnotationRule: %s.%s hadn't changed", deployment.ObjectMeta.Namespace, podNameForDeployment(deployment))
-		}
-	},
-	engine.WantDeployments,
-)
+		},
+		engine.WantDeployments,
+	)
+}
+
+var ResourceAnnotationRule = NewResourceAnnotationRule(DefaultResourceAnnotationParams())
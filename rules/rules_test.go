@@ -0,0 +1,203 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metatypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/uswitch/klint/engine/enginetest"
+)
+
+func deployment(name string, containers ...v1.Container) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, UID: metatypes.UID(name)},
+		Spec: appsv1.DeploymentSpec{
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{Containers: containers},
+			},
+		},
+	}
+}
+
+func limitedContainer(name string) v1.Container {
+	return v1.Container{
+		Name: name,
+		Resources: v1.ResourceRequirements{
+			Requests: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse("100m"),
+				v1.ResourceMemory: resource.MustParse("64Mi"),
+			},
+			Limits: v1.ResourceList{
+				v1.ResourceMemory: resource.MustParse("64Mi"),
+			},
+		},
+	}
+}
+
+func TestResourceAnnotationRule(t *testing.T) {
+	h := enginetest.New(t, ResourceAnnotationRule)
+
+	d := deployment("web", v1.Container{Name: "app"})
+	h.Create(d)
+
+	alerts := h.WaitForAlerts(1)
+	if !strings.Contains(alerts[0].Message, "(app)") {
+		t.Fatalf("expected alert about container app, got %q", alerts[0].Message)
+	}
+	if alerts[0].Target != enginetest.Target {
+		t.Fatalf("expected alert sent to %q, got %q", enginetest.Target, alerts[0].Target)
+	}
+	if ref := alerts[0].Alert.Object; ref.Kind != "Deployment" || ref.Namespace != enginetest.Namespace || ref.Name != "web" {
+		t.Fatalf("unexpected object reference %v", ref)
+	}
+
+	d = d.DeepCopy()
+	d.Spec.Template.Spec.Containers = []v1.Container{limitedContainer("app")}
+	h.Update(d)
+
+	alerts = h.WaitForAlerts(1)
+	if !alerts[0].Alert.Resolved() || alerts[0].Alert.Message != "Deployment/klint-test/web no longer breaks ResourceAnnotationRule" {
+		t.Fatalf("expected the alert to be resolved, got %q", alerts[0].Message)
+	}
+}
+
+func TestResourceAnnotationRuleIgnoresValidDeployments(t *testing.T) {
+	h := enginetest.New(t, ResourceAnnotationRule)
+
+	h.Create(deployment("web", limitedContainer("app")))
+
+	h.ExpectNoAlerts()
+}
+
+func TestScrapeNeedsPortsRule(t *testing.T) {
+	h := enginetest.New(t, ScrapeNeedsPortsRule)
+
+	d := deployment("metrics", v1.Container{Name: "app"})
+	d.Spec.Template.Annotations = map[string]string{"prometheus.io.scrape": "true"}
+	h.Create(d)
+
+	alerts := h.WaitForAlerts(1)
+	if !strings.Contains(alerts[0].Message, "needs to expose some ports") {
+		t.Fatalf("unexpected alert %q", alerts[0].Message)
+	}
+}
+
+func TestRequireCronJobHistoryLimits(t *testing.T) {
+	h := enginetest.New(t, RequireCronJobHistoryLimits)
+
+	tooMany := int32(20)
+	h.Create(&batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "backup", UID: "backup"},
+		Spec:       batchv1.CronJobSpec{SuccessfulJobsHistoryLimit: &tooMany},
+	})
+
+	alerts := h.WaitForAlerts(2)
+	if !strings.Contains(alerts[0].Message, "is too high: `20`") {
+		t.Fatalf("unexpected alert %q", alerts[0].Message)
+	}
+	if !strings.Contains(alerts[1].Message, "doesn't specify `.spec.failedJobsHistoryLimit`") {
+		t.Fatalf("unexpected alert %q", alerts[1].Message)
+	}
+
+	// fixing one limit only resolves its alert
+	three := int32(3)
+	h.Update(&batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "backup", UID: "backup"},
+		Spec:       batchv1.CronJobSpec{SuccessfulJobsHistoryLimit: &three},
+	})
+
+	alerts = h.WaitForAlerts(1)
+	if !alerts[0].Alert.Resolved() || !strings.HasSuffix(alerts[0].Alert.Message, "(successfulJobsHistoryLimit)") {
+		t.Fatalf("expected the successful limit to be resolved, got %q", alerts[0].Message)
+	}
+	h.ExpectNoAlerts()
+}
+
+func TestIngressNeedsAnnotation(t *testing.T) {
+	h := enginetest.New(t, IngressNeedsAnnotation)
+
+	h.Create(&networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "unwatched", UID: "unwatched"}})
+	h.WaitForAlerts(1)
+
+	h.Create(&networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{
+		Name:        "watched",
+		UID:         "watched",
+		Annotations: map[string]string{"com.uswitch.heimdall/5xx-rate": "0.1"},
+	}})
+	h.ExpectNoAlerts()
+}
+
+func TestUnsuccessfulExitRule(t *testing.T) {
+	h := enginetest.New(t, UnsuccessfulExitRule)
+
+	h.Create(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "crashing", UID: "crashing"},
+		Status: v1.PodStatus{
+			ContainerStatuses: []v1.ContainerStatus{
+				{
+					Name:  "app",
+					State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 1}},
+				},
+			},
+		},
+	})
+
+	alerts := h.WaitForAlerts(1)
+	if !strings.Contains(alerts[0].Message, "exit code: `1`") || !strings.Contains(alerts[0].Message, "fake logs") {
+		t.Fatalf("expected exit code and logs, got %q", alerts[0].Message)
+	}
+}
+
+func TestUnsuccessfulExitRuleDoesntResolveCrashLoops(t *testing.T) {
+	h := enginetest.New(t, NewUnsuccessfulExitRule(DefaultUnsuccessfulExitParams()))
+
+	crashed := v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 1, ContainerID: "first"}}
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "crashing", UID: "crashing"},
+		Status: v1.PodStatus{
+			ContainerStatuses: []v1.ContainerStatus{{Name: "app", State: crashed}},
+		},
+	}
+	h.Create(pod)
+	h.WaitForAlerts(1)
+
+	// waiting to restart, then crashing again, is the same violation
+	restart := func(state v1.ContainerState, last v1.ContainerState, ready bool) {
+		pod = pod.DeepCopy()
+		pod.Status.ContainerStatuses[0] = v1.ContainerStatus{
+			Name:                 "app",
+			State:                state,
+			LastTerminationState: last,
+			Ready:                ready,
+			RestartCount:         pod.Status.ContainerStatuses[0].RestartCount + 1,
+		}
+		h.Update(pod)
+	}
+	restart(v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}, crashed, false)
+	restart(v1.ContainerState{Running: &v1.ContainerStateRunning{}}, crashed, false)
+	restart(v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 1, ContainerID: "second"}}, crashed, false)
+	h.ExpectNoAlerts()
+
+	logs := 0
+	for _, action := range h.Client.Actions() {
+		if action.GetSubresource() == "log" {
+			logs++
+		}
+	}
+	if logs != 1 {
+		t.Errorf("expected the logs to be fetched once, got %d", logs)
+	}
+
+	// once it's up and ready it's fixed
+	restart(v1.ContainerState{Running: &v1.ContainerStateRunning{}}, crashed, true)
+	if alerts := h.WaitForAlerts(1); !alerts[0].Alert.Resolved() {
+		t.Fatalf("expected the alert to be resolved, got %q", alerts[0].Message)
+	}
+}
@@ -1,8 +1,6 @@
 package rules
 
 import (
-	log "github.com/sirupsen/logrus"
-
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 
@@ -24,22 +22,17 @@ func validScrapeAndPorts(d *appsv1.Deployment) bool {
 }
 
 var ScrapeNeedsPortsRule = engine.NewRule(
+	engine.RuleMeta{
+		Name:        "ScrapeNeedsPortsRule",
+		Description: "Deployments that ask to be scraped by Prometheus should expose ports.",
+		Severity:    engine.SeverityWarning,
+		DocsURL:     "https://github.com/uswitch/klint#scrapeneedsportsrule",
+	},
 	func(old runtime.Object, new runtime.Object, ctx *engine.RuleHandlerContext) {
 		deployment := new.(*appsv1.Deployment)
-		logger := log.WithFields(log.Fields{"name": deployment.Name, "namespace": deployment.Namespace, "rule": "ScrapeNeedsPortsRule"})
-
-		if old == nil || validScrapeAndPorts(old.(*appsv1.Deployment)) != validScrapeAndPorts(deployment) {
-			podName := podNameForDeployment(deployment)
 
-			if validScrapeAndPorts(deployment) { // everything is good
-				if old != nil {
-					ctx.Alertf(new, "Thanks for sorting the ports for scraping on %s.%s", deployment.ObjectMeta.Namespace, podName)
-				}
-			} else { // stuff has gone bad
-				ctx.Alertf(new, "%s.%s wants to be scraped so it needs to expose some ports", deployment.ObjectMeta.Namespace, podName)
-			}
-		} else {
-			logger.Debugf("ScrapeNeedsPortsRule: %s.%s hadn't changed", deployment.ObjectMeta.Namespace, podNameForDeployment(deployment))
+		if !validScrapeAndPorts(deployment) {
+			ctx.Alertf(new, "%s.%s wants to be scraped so it needs to expose some ports", deployment.ObjectMeta.Namespace, podNameForDeployment(deployment))
 		}
 	},
 	engine.WantDeployments,
@@ -1,68 +1,195 @@
 package rules
 
 import (
-	"context"
 	"fmt"
+	"sync"
 
 	log "github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 
 	"github.com/uswitch/klint/engine"
 )
 
-var UnsuccessfulExitRule = engine.NewRule(
-	func(old runtime.Object, newObj runtime.Object, ctx *engine.RuleHandlerContext) {
-		pod := newObj.(*v1.Pod)
-
-		logger := log.WithFields(log.Fields{"name": pod.Name, "namespace": pod.Namespace, "rule": "UnsuccessfulExitRule"})
-
-		for _, c := range pod.Status.ContainerStatuses {
-			logger = logger.WithFields(log.Fields{"container.name": c.Name, "container.id": c.ContainerID})
-			contx := context.Background()
-			if c.State.Terminated != nil {
-				switch exitCode := c.State.Terminated.ExitCode; exitCode {
-				case 0: // Everything was OK
-					break
-				case 143: // JVM SIGTERM
-					break
-				case 137: // Process got SIGKILLd
-					if c.State.Terminated.Reason == "OOMKilled" {
-						ctx.Alertf(newObj, "Pod `%s.%s` (container: `%s`) ran out of memory and was killed.", pod.ObjectMeta.Namespace, pod.ObjectMeta.Name, c.Name)
+type UnsuccessfulExitParams struct {
+	// TailLines is how many lines of the container's log to include.
+	TailLines int64 `json:"tailLines"`
+	// IgnoredExitCodes are treated as though the container exited successfully.
+	IgnoredExitCodes []int32 `json:"ignoredExitCodes"`
+}
+
+// DefaultUnsuccessfulExitParams returns new params each time so that decoding
+// config over them can't modify the shared slice.
+func DefaultUnsuccessfulExitParams() UnsuccessfulExitParams {
+	return UnsuccessfulExitParams{
+		TailLines:        20,
+		IgnoredExitCodes: []int32{143}, // JVM SIGTERM
+	}
+}
+
+func (p UnsuccessfulExitParams) Validate() error {
+	if p.TailLines < 0 {
+		return fmt.Errorf("tailLines must not be negative")
+	}
+	return nil
+}
+
+// lastTermination is how the container last exited, and whether it has been
+// restarted since. A container that's waiting to start again after failing
+// is still reported on, or running but not yet ready, so that crash loops
+// don't resolve every time it comes back up. Once it's ready the failure is
+// over.
+func lastTermination(c v1.ContainerStatus) (*v1.ContainerStateTerminated, bool) {
+	switch {
+	case c.State.Terminated != nil:
+		return c.State.Terminated, false
+	case c.State.Running != nil && c.Ready:
+		return nil, false
+	}
+	return c.LastTerminationState.Terminated, true
+}
+
+// failure is what was reported for a container's failure, so that the same
+// message is used for as long as it keeps failing the same way.
+type failure struct {
+	exitCode int32
+	reason   string
+	message  string
+}
+
+// failures remembers the message with logs reported for each failing
+// container, by pod UID and container name, so that its logs are only
+// fetched once rather than every time the pod changes or restarts.
+type failures struct {
+	mu    sync.Mutex
+	byPod map[types.UID]map[string]failure
+}
+
+func (f *failures) get(uid types.UID, container string, terminated *v1.ContainerStateTerminated) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	last, ok := f.byPod[uid][container]
+	if !ok || last.exitCode != terminated.ExitCode || last.reason != terminated.Reason {
+		return "", false
+	}
+	return last.message, true
+}
+
+func (f *failures) set(uid types.UID, container string, terminated *v1.ContainerStateTerminated, message string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.byPod[uid] == nil {
+		f.byPod[uid] = map[string]failure{}
+	}
+	f.byPod[uid][container] = failure{exitCode: terminated.ExitCode, reason: terminated.Reason, message: message}
+}
+
+func (f *failures) forget(uid types.UID, container string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.byPod[uid], container)
+	if len(f.byPod[uid]) == 0 {
+		delete(f.byPod, uid)
+	}
+}
+
+func (f *failures) forgetPod(uid types.UID) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.byPod, uid)
+}
+
+func NewUnsuccessfulExitRule(params UnsuccessfulExitParams) *engine.Rule {
+	ignored := map[int32]bool{0: true} // Everything was OK
+	for _, code := range params.IgnoredExitCodes {
+		ignored[code] = true
+	}
+
+	reported := &failures{byPod: map[types.UID]map[string]failure{}}
+
+	rule := engine.NewRule(
+		engine.RuleMeta{
+			Name:        "UnsuccessfulExitRule",
+			Description: "Containers should exit successfully, and within their termination grace period.",
+			Severity:    engine.SeverityWarning,
+			DocsURL:     "https://github.com/uswitch/klint#unsuccessfulexitrule",
+		},
+		func(old runtime.Object, newObj runtime.Object, ctx *engine.RuleHandlerContext) {
+			pod := newObj.(*v1.Pod)
+
+			logger := log.WithFields(log.Fields{"name": pod.Name, "namespace": pod.Namespace, "rule": "UnsuccessfulExitRule"})
+
+			for _, c := range pod.Status.ContainerStatuses {
+				logger = logger.WithFields(log.Fields{"container.name": c.Name, "container.id": c.ContainerID})
+				terminated, previous := lastTermination(c)
+				if terminated == nil || ignored[terminated.ExitCode] {
+					reported.forget(pod.UID, c.Name)
+					continue
+				}
+
+				switch exitCode := terminated.ExitCode; {
+				case exitCode == 137: // Process got SIGKILLd
+					if terminated.Reason == "OOMKilled" {
+						ctx.AlertKeyf(newObj, c.Name, "Pod `%s.%s` (container: `%s`) ran out of memory and was killed.", pod.ObjectMeta.Namespace, pod.ObjectMeta.Name, c.Name)
 					} else {
-						ctx.Alertf(newObj, "Pod `%s.%s` (container: `%s`) was killed by a SIGKILL. Please make sure you gracefully shut down in time or extend `terminationGracePeriodSeconds` on your pod.", pod.ObjectMeta.Namespace, pod.ObjectMeta.Name, c.Name)
+						ctx.AlertKeyf(newObj, c.Name, "Pod `%s.%s` (container: `%s`) was killed by a SIGKILL. Please make sure you gracefully shut down in time or extend `terminationGracePeriodSeconds` on your pod.", pod.ObjectMeta.Namespace, pod.ObjectMeta.Name, c.Name)
 					}
 				default:
-					tailLines := int64(20)
+					tailLines := params.TailLines
 					opts := &v1.PodLogOptions{
 						Container: c.Name,
 						Follow:    false,
-						Previous:  false,
+						Previous:  previous,
 						TailLines: &tailLines,
 					}
-					message := fmt.Sprintf("Pod `%s.%s` (container: `%s`) has failed with exit code: `%d`", pod.ObjectMeta.Namespace, pod.ObjectMeta.Name, c.Name, c.State.Terminated.ExitCode)
+					message := fmt.Sprintf("Pod `%s.%s` (container: `%s`) has failed with exit code: `%d`", pod.ObjectMeta.Namespace, pod.ObjectMeta.Name, c.Name, exitCode)
+
+					if ctx.Client() == nil || tailLines == 0 { // linting a manifest or logs are turned off
+						ctx.AlertKey(newObj, c.Name, message)
+						continue
+					}
+
+					if withLogs, ok := reported.get(pod.UID, c.Name, terminated); ok {
+						ctx.AlertKey(newObj, c.Name, withLogs)
+						continue
+					}
 
-					result := ctx.Client().CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, opts).Do(contx)
+					result := ctx.Client().CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, opts).Do(ctx.Context())
 					if result.Error() != nil {
 						logger.Errorf("error retrieving pod logs: %s", result.Error())
-						ctx.Alert(newObj, message)
-						return
+						ctx.AlertKey(newObj, c.Name, message)
+						continue
 					}
 
 					bytes, err := result.Raw()
 					if err != nil {
 						logger.Errorf("error retrieving pod logs: %s", err.Error())
-						ctx.Alert(newObj, message)
-						return
+						ctx.AlertKey(newObj, c.Name, message)
+						continue
 					}
 
 					logger.Debugf("log: \"%s\"", string(bytes))
-					ctx.Alertf(newObj, "%s\n\n```%s```", message, string(bytes))
+					withLogs := fmt.Sprintf("%s\n\n```%s```", message, string(bytes))
+					reported.set(pod.UID, c.Name, terminated, withLogs)
+					ctx.AlertKey(newObj, c.Name, withLogs)
 				}
 			}
-		}
-	},
-	engine.WantPods,
-)
+		},
+		engine.WantPods,
+	)
+
+	rule.DeleteHandler = func(obj runtime.Object, _ *engine.RuleHandlerContext) {
+		reported.forgetPod(obj.(*v1.Pod).UID)
+	}
+
+	return rule
+}
+
+var UnsuccessfulExitRule = NewUnsuccessfulExitRule(DefaultUnsuccessfulExitParams())
 
 // can we not show exit code 143 and co if the pod is terminating, it is noisy
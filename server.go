@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/uswitch/klint/engine"
+)
+
+// probe responds 200 if check passes, or 503 with its error.
+func probe(check func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := check(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// serveHTTP serves klint's metrics and probes on address.
+func serveHTTP(address string, e *engine.Engine) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/healthz", probe(e.Healthy))
+	mux.Handle("/readyz", probe(e.Ready))
+
+	log.Infof("serving metrics and probes on %s", address)
+
+	err := http.ListenAndServe(address, mux)
+	log.Fatalf("error serving metrics and probes: %s", err)
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/uswitch/klint/alerts"
+	"github.com/uswitch/klint/config"
+	"github.com/uswitch/klint/engine"
+	"github.com/uswitch/klint/rules"
+)
+
+// settings are everything the config controls, and so can be reloaded.
+type settings struct {
+	rules   []*engine.Rule
+	outputs []engine.Output
+	repeat  engine.RepeatPolicy
+}
+
+func buildSettings(opts *options, cfg *config.Config) (*settings, error) {
+	enabled, repeat, err := buildRules(opts, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs, err := buildOutputs(opts, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &settings{rules: enabled, outputs: outputs, repeat: repeat}, nil
+}
+
+// buildRules builds the rules and how often they remind about violations,
+// which needs nothing outside the config.
+func buildRules(opts *options, cfg *config.Config) ([]*engine.Rule, engine.RepeatPolicy, error) {
+	enabled, err := rules.FromConfig(cfg)
+	if err != nil {
+		return nil, engine.RepeatPolicy{}, err
+	}
+
+	repeat, err := rules.RepeatPolicyFromConfig(cfg, opts.repeatInterval)
+	if err != nil {
+		return nil, engine.RepeatPolicy{}, err
+	}
+
+	return enabled, repeat, nil
+}
+
+// buildOutputs builds the outputs, reading their secrets from the
+// environment, so it's only needed when alerts are sent.
+func buildOutputs(opts *options, cfg *config.Config) ([]engine.Output, error) {
+	outputs := []engine.Output{}
+
+	if len(opts.slackToken) > 0 && cfg.Outputs.Slack.IsEnabled() {
+		outputs = append(outputs, alerts.NewSlackOutput(opts.slackToken))
+	}
+
+	if cfg.Outputs.SNS.IsEnabled() {
+		region := opts.awsRegion
+		if cfg.Outputs.SNS.Region != "" {
+			region = cfg.Outputs.SNS.Region
+		}
+		outputs = append(outputs, alerts.NewSNSOutput(region))
+	}
+
+	if len(cfg.Outputs.PagerDuty.Services) > 0 && cfg.Outputs.PagerDuty.IsEnabled() {
+		routingKeys, err := pagerDutyRoutingKeys(cfg.Outputs.PagerDuty)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, alerts.NewPagerDutyOutput(cfg.Outputs.PagerDuty.URL, routingKeys))
+	}
+
+	if len(opts.opsgenieAPIKey) > 0 && cfg.Outputs.Opsgenie.IsEnabled() {
+		outputs = append(outputs, alerts.NewOpsgenieOutput(opts.opsgenieAPIKey, cfg.Outputs.Opsgenie.URL))
+	}
+
+	if len(cfg.Outputs.MSTeams.Webhooks) > 0 {
+		webhooks, err := chatWebhooks("msteams", cfg.Outputs.MSTeams)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, alerts.NewMSTeamsOutput(webhooks))
+	}
+
+	if len(cfg.Outputs.GoogleChat.Webhooks) > 0 {
+		webhooks, err := chatWebhooks("googlechat", cfg.Outputs.GoogleChat)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, alerts.NewGoogleChatOutput(webhooks))
+	}
+
+	if len(cfg.Outputs.Webhooks) > 0 {
+		endpoints, err := webhookEndpoints(cfg.Outputs.Webhooks)
+		if err != nil {
+			return nil, err
+		}
+
+		webhooks, err := alerts.NewWebhookOutput(endpoints)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, webhooks)
+	}
+
+	return outputs, nil
+}
+
+// webhookEndpoints reads the secrets for each webhook from the environment.
+func webhookEndpoints(webhooks map[string]config.WebhookConfig) (map[string]alerts.WebhookEndpoint, error) {
+	endpoints := map[string]alerts.WebhookEndpoint{}
+
+	for name, webhook := range webhooks {
+		if webhook.URL == "" {
+			return nil, fmt.Errorf("webhook %s needs a url", name)
+		}
+
+		endpoint := alerts.WebhookEndpoint{
+			URL:     webhook.URL,
+			Headers: webhook.Headers,
+			Body:    webhook.Body,
+		}
+
+		var err error
+		if endpoint.BearerToken, err = secretFromEnv(webhook.BearerTokenEnv); err != nil {
+			return nil, fmt.Errorf("webhook %s: %s", name, err)
+		}
+		if endpoint.SigningSecret, err = secretFromEnv(webhook.SigningSecretEnv); err != nil {
+			return nil, fmt.Errorf("webhook %s: %s", name, err)
+		}
+		if webhook.BasicAuth != nil {
+			if webhook.BearerTokenEnv != "" {
+				return nil, fmt.Errorf("webhook %s can't use both a bearer token and basic auth", name)
+			}
+			endpoint.Username = webhook.BasicAuth.Username
+			if endpoint.Password, err = secretFromEnv(webhook.BasicAuth.PasswordEnv); err != nil {
+				return nil, fmt.Errorf("webhook %s: %s", name, err)
+			}
+		}
+
+		endpoints[name] = endpoint
+	}
+
+	return endpoints, nil
+}
+
+// chatWebhooks reads the URL of each of a chat output's webhooks from the
+// environment.
+func chatWebhooks(output string, cfg config.ChatConfig) (map[string]string, error) {
+	webhooks := map[string]string{}
+
+	for name, webhook := range cfg.Webhooks {
+		if webhook.URLEnv == "" {
+			return nil, fmt.Errorf("%s webhook %s needs a urlEnv", output, name)
+		}
+
+		url, err := secretFromEnv(webhook.URLEnv)
+		if err != nil {
+			return nil, fmt.Errorf("%s webhook %s: %s", output, name, err)
+		}
+		webhooks[name] = url
+	}
+
+	return webhooks, nil
+}
+
+// pagerDutyRoutingKeys reads the integration key of each PagerDuty service
+// from the environment.
+func pagerDutyRoutingKeys(cfg config.PagerDutyConfig) (map[string]string, error) {
+	routingKeys := map[string]string{}
+
+	for name, service := range cfg.Services {
+		if service.RoutingKeyEnv == "" {
+			return nil, fmt.Errorf("pagerduty service %s needs a routingKeyEnv", name)
+		}
+
+		key, err := secretFromEnv(service.RoutingKeyEnv)
+		if err != nil {
+			return nil, fmt.Errorf("pagerduty service %s: %s", name, err)
+		}
+		routingKeys[name] = key
+	}
+
+	return routingKeys, nil
+}
+
+// secretFromEnv returns the value of the environment variable env, which
+// must be set unless env is empty.
+func secretFromEnv(env string) (string, error) {
+	if env == "" {
+		return "", nil
+	}
+
+	value, ok := os.LookupEnv(env)
+	if !ok || value == "" {
+		return "", fmt.Errorf("environment variable %s isn't set", env)
+	}
+	return value, nil
+}
+
+// parseConfig parses data, returning the defaults when it's nil.
+func parseConfig(data []byte) (*config.Config, error) {
+	if data == nil {
+		return &config.Config{}, nil
+	}
+	return config.Parse(data)
+}
+
+func parseSettings(opts *options, data []byte) (*settings, error) {
+	cfg, err := parseConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildSettings(opts, cfg)
+}
+
+// splitConfigMap splits the value of a namespace/name flag.
+func splitConfigMap(flag, value string) (string, string, error) {
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("--%s should be namespace/name, not %q", flag, value)
+	}
+	return parts[0], parts[1], nil
+}
+
+// readConfig reads the config from the ConfigMap given with --config-map or
+// the file given with --config. Without either it returns nil, meaning the
+// defaults should be used.
+func readConfig(opts *options, client kubernetes.Interface) ([]byte, error) {
+	if opts.configMap != "" {
+		if client == nil {
+			return nil, fmt.Errorf("--config-map can only be used against a cluster")
+		}
+
+		namespace, name, err := splitConfigMap("config-map", opts.configMap)
+		if err != nil {
+			return nil, err
+		}
+
+		return config.LoadConfigMap(context.Background(), client, namespace, name, opts.configMapKey)
+	}
+
+	if opts.configPath != "" {
+		return os.ReadFile(opts.configPath)
+	}
+
+	return nil, nil
+}
+
+func configSource(opts *options) string {
+	if opts.configMap != "" {
+		return fmt.Sprintf("ConfigMap %s key %s", opts.configMap, opts.configMapKey)
+	}
+	return opts.configPath
+}
+
+// loadConfig reads and parses the initial config, exiting if there are any
+// problems with it. client may be nil outside of a cluster.
+func loadConfig(opts *options, client kubernetes.Interface) (*config.Config, []byte) {
+	data, err := readConfig(opts, client)
+	if err != nil {
+		log.Fatalf("error loading config: %s", err)
+	}
+
+	cfg, err := parseConfig(data)
+	if err != nil {
+		log.Fatalf("error in config %s: %s", configSource(opts), err)
+	}
+
+	return cfg, data
+}
+
+// loadRules builds the rules the config enables, exiting if it can't.
+func loadRules(opts *options, cfg *config.Config) ([]*engine.Rule, engine.RepeatPolicy) {
+	enabled, repeat, err := buildRules(opts, cfg)
+	if err != nil {
+		log.Fatalf("error in config %s: %s", configSource(opts), err)
+	}
+
+	names := []string{}
+	for _, rule := range enabled {
+		names = append(names, rule.Name)
+	}
+	log.Infof("enabled rules: %s", strings.Join(names, ", "))
+
+	return enabled, repeat
+}
+
+// loadOutputs builds the outputs the config and flags enable, exiting if it
+// can't, e.g. when a secret isn't in the environment.
+func loadOutputs(opts *options, cfg *config.Config) []engine.Output {
+	outputs, err := buildOutputs(opts, cfg)
+	if err != nil {
+		log.Fatalf("error in config %s: %s", configSource(opts), err)
+	}
+	return outputs
+}
+
+// watchConfig reloads the engine whenever the config changes. A config with
+// problems is rejected and the engine keeps what it has.
+func watchConfig(ctx context.Context, opts *options, client kubernetes.Interface, current []byte, e *engine.Engine) {
+	reload := func(data []byte) {
+		s, err := parseSettings(opts, data)
+		if err != nil {
+			log.Errorf("rejecting new config from %s, keeping the previous one: %s", configSource(opts), err)
+			return
+		}
+
+		e.Reload(s.rules, s.outputs, s.repeat)
+	}
+
+	if opts.configMap != "" {
+		namespace, name, _ := splitConfigMap("config-map", opts.configMap)
+		config.WatchConfigMap(ctx, client, namespace, name, opts.configMapKey, current, reload)
+	} else if opts.configPath != "" && opts.configReloadInterval > 0 {
+		config.WatchFile(ctx, opts.configPath, current, opts.configReloadInterval, reload)
+	}
+}